@@ -1,10 +1,13 @@
 package http
 
 import (
+	"context"
 	"github.com/caijinlin/golib/helper"
 	"github.com/caijinlin/golib/log"
 	"net"
 	"net/http"
+	neturl "net/url"
+	"strings"
 	"time"
 )
 
@@ -18,6 +21,7 @@ type Client struct {
 	KeepAlive           int // 长连接过期时间，单位秒
 	MaxIdleConnsPerHost int
 	Handler             *http.Client
+	Logger              *log.Logger // http_call日志的输出，nil时使用log.Default()
 }
 
 const (
@@ -87,52 +91,93 @@ func (client *Client) SetHandler(Handler *http.Client) {
 // client API
 
 func Get(url string, params map[string]interface{}) (*Response, error) {
-	return defaultClient.do(http.MethodGet, url, params)
+	return defaultClient.do(context.Background(), http.MethodGet, url, params)
 }
 
 func Post(url string, params map[string]interface{}) (*Response, error) {
-	return defaultClient.do(http.MethodPost, url, params)
+	return defaultClient.do(context.Background(), http.MethodPost, url, params)
 }
 
 func Put(url string, params map[string]interface{}) (*Response, error) {
-	return defaultClient.do(http.MethodPut, url, params)
+	return defaultClient.do(context.Background(), http.MethodPut, url, params)
 }
 
 func Delete(url string, params map[string]interface{}) (*Response, error) {
-	return defaultClient.do(http.MethodDelete, url, params)
+	return defaultClient.do(context.Background(), http.MethodDelete, url, params)
+}
+
+// 带ctx的版本：ctx控制请求取消/超时，其中的trace_id记录到http_call日志
+
+func GetContext(ctx context.Context, url string, params map[string]interface{}) (*Response, error) {
+	return defaultClient.do(ctx, http.MethodGet, url, params)
+}
+
+func PostContext(ctx context.Context, url string, params map[string]interface{}) (*Response, error) {
+	return defaultClient.do(ctx, http.MethodPost, url, params)
+}
+
+func PutContext(ctx context.Context, url string, params map[string]interface{}) (*Response, error) {
+	return defaultClient.do(ctx, http.MethodPut, url, params)
+}
+
+func DeleteContext(ctx context.Context, url string, params map[string]interface{}) (*Response, error) {
+	return defaultClient.do(ctx, http.MethodDelete, url, params)
 }
 
 func (client *Client) Get(url string, params map[string]interface{}) (*Response, error) {
-	return client.do(http.MethodGet, url, params)
+	return client.do(context.Background(), http.MethodGet, url, params)
 }
 
 func (client *Client) Post(url string, params map[string]interface{}) (*Response, error) {
-	return client.do(http.MethodPost, url, params)
+	return client.do(context.Background(), http.MethodPost, url, params)
 }
 
 func (client *Client) Put(url string, params map[string]interface{}) (*Response, error) {
-	return client.do(http.MethodPut, url, params)
+	return client.do(context.Background(), http.MethodPut, url, params)
 }
 
 func (client *Client) Delete(url string, params map[string]interface{}) (*Response, error) {
-	return client.do(http.MethodDelete, url, params)
+	return client.do(context.Background(), http.MethodDelete, url, params)
+}
+
+func (client *Client) GetContext(ctx context.Context, url string, params map[string]interface{}) (*Response, error) {
+	return client.do(ctx, http.MethodGet, url, params)
+}
+
+func (client *Client) PostContext(ctx context.Context, url string, params map[string]interface{}) (*Response, error) {
+	return client.do(ctx, http.MethodPost, url, params)
+}
+
+func (client *Client) PutContext(ctx context.Context, url string, params map[string]interface{}) (*Response, error) {
+	return client.do(ctx, http.MethodPut, url, params)
+}
+
+func (client *Client) DeleteContext(ctx context.Context, url string, params map[string]interface{}) (*Response, error) {
+	return client.do(ctx, http.MethodDelete, url, params)
+}
+
+func (client *Client) logger() *log.Logger {
+	if client.Logger != nil {
+		return client.Logger
+	}
+	return log.Default()
 }
 
 /**
 * 统一收敛调用入口，并加上耗时统计
  */
-func (client *Client) do(method string, url string, params map[string]interface{}) (response *Response, err error) {
+func (client *Client) do(ctx context.Context, method string, url string, params map[string]interface{}) (response *Response, err error) {
 
 	start := time.Now()
 	defer func() {
 		cost := time.Now().Sub(start)
 		errmsg := ""
 		if err != nil {
-			errmsg = err.Error()
+			errmsg = logError(err)
 		}
-		log.Info(map[string]interface{}{
+		client.logger().WithContext(ctx).Info(map[string]interface{}{
 			"action": "http_call",
-			"url":    url,
+			"url":    stripQuery(url),
 			"method": method,
 			"params": params,
 			"cost":   helper.FormatDurationToMs(cost),
@@ -140,13 +185,18 @@ func (client *Client) do(method string, url string, params map[string]interface{
 		})
 	}()
 
+	// 日志中的url以及errmsg不含query，GET参数只通过params记录，由RedactKeys打码
+	reqUrl := url
 	if method == http.MethodGet {
 		queryVals := helper.Map2UrlParams(params)
 		if queryVals != "" {
-			url += "?" + queryVals
+			reqUrl += "?" + queryVals
 		}
 	}
-	req := makeRequest(method, url, params)
+	req, err := makeRequest(ctx, method, reqUrl, params)
+	if err != nil {
+		return nil, err
+	}
 	resp, err := client.Handler.Do(req)
 	if err != nil {
 		return nil, err
@@ -156,3 +206,23 @@ func (client *Client) do(method string, url string, params map[string]interface{
 	response.resp = resp
 	return response, err
 }
+
+/**
+* 去掉url中的query以及fragment，query中可能有token等敏感参数，不记录日志
+ */
+func stripQuery(url string) string {
+	if i := strings.IndexAny(url, "?#"); i >= 0 {
+		return url[:i]
+	}
+	return url
+}
+
+/**
+* 日志中的错误信息，net/http返回的*url.Error包含完整的请求url，去掉其中的query
+ */
+func logError(err error) string {
+	if e, ok := err.(*neturl.Error); ok {
+		return (&neturl.Error{Op: e.Op, URL: stripQuery(e.URL), Err: e.Err}).Error()
+	}
+	return err.Error()
+}
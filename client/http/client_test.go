@@ -1,7 +1,14 @@
 package http
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"github.com/caijinlin/golib/log"
+	syslog "log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -24,3 +31,60 @@ func TestPost(t *testing.T) {
 	}
 	fmt.Println(resp.Protocol(), resp.GetStatusCode())
 }
+
+/**
+* GET参数拼接到url后，http_call日志中的url不应包含未打码的参数
+ */
+func TestRedactQuery(t *testing.T) {
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("token") != "tk-123456" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	lg, err := log.New(log.LogConfig{Type: "std", Level: "INFO", Format: log.FORMAT_JSON, RedactKeys: []string{"password|token"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	lg.SetLogger(syslog.New(buf, "", 0))
+
+	client := New(1000, 100, 30, 100)
+	client.Logger = lg
+	resp, err := client.Get(server.URL+"/login", map[string]interface{}{"user": "tom", "password": "secret", "token": "tk-123456"})
+	if err != nil || resp.GetStatusCode() != http.StatusOK {
+		t.Fatalf("unexpected response %v", err)
+	}
+
+	var entry struct {
+		Url    string            `json:"url"`
+		Params map[string]string `json:"params"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "secret") || strings.Contains(buf.String(), "tk-123456") ||
+		entry.Url != server.URL+"/login" || entry.Params["user"] != "tom" {
+		t.Fatalf("unexpected log %s", buf.String())
+	}
+
+	// 请求失败时errmsg中的url以及调用方自带query的url同样不含query
+	server.Close()
+	buf.Reset()
+	if _, err := client.Get(server.URL+"/login?sign=sg-123456", map[string]interface{}{"password": "secret"}); err == nil {
+		t.Fatal("expect request to closed server failed")
+	}
+	var failed struct {
+		Url    string `json:"url"`
+		Errmsg string `json:"errmsg"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &failed); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "secret") || strings.Contains(buf.String(), "sg-123456") ||
+		failed.Url != server.URL+"/login" || !strings.Contains(failed.Errmsg, server.URL+"/login\"") {
+		t.Fatalf("unexpected log %s", buf.String())
+	}
+}
@@ -1,18 +1,19 @@
 package http
 
 import (
+	"context"
 	"github.com/caijinlin/golib/helper"
 	"net/http"
 )
 
-func makeRequest(method string, url string, params map[string]interface{}) *http.Request {
+func makeRequest(ctx context.Context, method string, url string, params map[string]interface{}) (*http.Request, error) {
 
-	request, err := http.NewRequest(method, url, helper.Map2Buffer(params))
+	request, err := http.NewRequestWithContext(ctx, method, url, helper.Map2Buffer(params))
 
 	if err == nil {
 		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 		request.Header.Set("Connection", "keep-alive")
 	}
 
-	return request
+	return request, err
 }
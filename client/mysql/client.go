@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -26,6 +27,8 @@ type Client struct {
 
 	// 系统默认*sql.DB
 	DB *gorm.DB // 应该是个interface
+
+	Logger *log.Logger `json:"-"` // mysql_call日志的输出，nil时使用log.Default()
 }
 
 /**
@@ -58,10 +61,27 @@ func (client *Client) Init() {
 	var err error
 	client.DB, err = driver.NewGorm(client.genDsn())
 	if err != nil {
-		log.Errorf(err.Error())
+		client.logger().Errorf("%s", err.Error())
 		os.Exit(1)
 	}
+	client.DB.SetLogger(&driver.GormLogger{Logger: client.Logger})
 	// gorm->DB() = sql.DB
 	client.DB.DB().SetMaxIdleConns(client.MaxIdle)
 	client.DB.DB().SetMaxOpenConns(client.MaxActive)
 }
+
+/**
+* 返回使用ctx中trace_id记录mysql_call日志的DB
+**/
+func (client *Client) WithContext(ctx context.Context) *gorm.DB {
+	db := client.DB.New()
+	db.SetLogger(&driver.GormLogger{Ctx: ctx, Logger: client.Logger})
+	return db
+}
+
+func (client *Client) logger() *log.Logger {
+	if client.Logger != nil {
+		return client.Logger
+	}
+	return log.Default()
+}
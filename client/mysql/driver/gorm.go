@@ -1,6 +1,7 @@
 package driver
 
 import (
+	"context"
 	"database/sql/driver"
 	"fmt"
 	"github.com/caijinlin/golib/helper"
@@ -24,6 +25,8 @@ func NewGorm(dsn string) (*gorm.DB, error) {
 }
 
 type GormLogger struct {
+	Ctx    context.Context // 携带trace_id，为nil时使用全局trace_id
+	Logger *log.Logger     // 为nil时使用log.Default()
 }
 
 // see https://github.com/jinzhu/gorm/blob/master/logger.go
@@ -34,8 +37,13 @@ func (logger GormLogger) Print(values ...interface{}) {
 	if len(values) > 1 {
 		level := values[0]
 		position := fmt.Sprintf("%v", values[1])
+		lg := logger.Logger
+		if lg == nil {
+			lg = log.Default()
+		}
+		clog := lg.WithContext(logger.Ctx)
 		if level == "sql" {
-			log.Info(map[string]interface{}{
+			clog.Info(map[string]interface{}{
 				"action":   "mysql_call",
 				"sql":      FormatedSql(values...),
 				"cost":     helper.FormatDurationToMs(values[2].(time.Duration)),
@@ -43,7 +51,7 @@ func (logger GormLogger) Print(values ...interface{}) {
 				"position": position,
 			})
 		} else {
-			log.Warning(map[string]interface{}{
+			clog.Warning(map[string]interface{}{
 				"action":   "mysql_call",
 				"errmsg":   fmt.Sprintf("%s", values[2:]...),
 				"position": position,
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -12,23 +13,62 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"net"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Client struct {
-	ConnTimeoutMs   int // 单位毫秒
-	WriteTimeoutMs  int // 单位毫秒
-	ReadTimeoutMs   int // 单位毫秒
-	IdleTimeoutS    int // 单位秒
-	MaxIdle         int // 连接池中的最大连接数
-	MaxActive       int // 最大活跃数
+	ConnTimeoutMs   int    // 单位毫秒
+	WriteTimeoutMs  int    // 单位毫秒
+	ReadTimeoutMs   int    // 单位毫秒
+	IdleTimeoutS    int    // 单位秒
+	MaxLifetimeS    int    // 连接最大存活时间，单位秒，0表示不限制，主从切换后用于回收旧连接
+	MaxIdle         int    // 连接池中的最大连接数，MaxIdle/MinIdle/MaxActive为整个client的总数，多个Servers时按权重分到各个server
+	MinIdle         int    // 连接池中的最少连接数，Init时预热
+	MaxActive       int    // 最大活跃数
+	WaitTimeoutMs   int    // 连接数达到上限时获取连接的最长等待时间，单位毫秒，0表示一直等待
+	IdleStrategy    string // 空闲连接复用策略 lifo/fifo，默认lifo，fifo使连接轮流使用，负载分散到各个server
 	SentinelServers []string
 	Servers         []string
+	Weights         []int  // 与Servers一一对应的权重，默认1
+	Balance         string // Servers选择策略 random(按权重随机，默认)/roundrobin/leastconn
 	RedisSet        string
 	Password        string
 	Db              int
-	pool            *pool.ConnPool
-	spool           *pool.ConnPool // sentinel连接池master
+	WatchRetries    int                            // Watch时EXEC冲突的最大重试次数，默认3
+	Logger          *log.Logger                    `json:"-"` // redis_call等日志的输出，nil时使用log.Default()
+	pool            *pool.MultiPool[redislib.Conn] // 每个server一个连接池，故障节点自动摘除
+	spool           *pool.Pool[redislib.Conn]      // sentinel连接池master
+	metricsName     string                         // 注册到pool.DefaultExporter的名称
+}
+
+func (client *Client) logger() *log.Logger {
+	if client.Logger != nil {
+		return client.Logger
+	}
+	return log.Default()
+}
+
+// withConn中fn未正常返回，连接状态未知
+var errConnAborted = errors.New("redis: connection aborted")
+
+/**
+* Do等使用的连接池，单个连接池与多节点连接池都满足
+ */
+type connPool interface {
+	GetContext(ctx context.Context) (redislib.Conn, error)
+	PutWithError(conn redislib.Conn, err error)
+}
+
+/**
+* 写命令在sentinel模式下使用master连接池，其余使用Servers连接池
+ */
+func (client *Client) getPool(write bool) connPool {
+	if write && len(client.SentinelServers) > 0 {
+		return client.spool
+	}
+	return client.pool
 }
 
 /**
@@ -49,6 +89,7 @@ func Init(confFile string) (clients map[string]*Client, err error) {
 	}
 	for key, _ := range clients {
 		clients[key].Init()
+		clients[key].RegisterMetrics(key)
 	}
 
 	return
@@ -64,7 +105,24 @@ func (client *Client) Init() {
 	}
 }
 
+/**
+* 将连接池统计注册到pool.DefaultExporter，name一般取配置文件中的key
+**/
+func (client *Client) RegisterMetrics(name string) {
+	client.metricsName = "redis." + name
+	if client.pool != nil {
+		pool.DefaultExporter.Register(client.metricsName, client.pool)
+	}
+	if client.spool != nil {
+		pool.DefaultExporter.Register(client.metricsName+".master", client.spool)
+	}
+}
+
 func (client *Client) Close() {
+	if client.metricsName != "" {
+		pool.DefaultExporter.Unregister(client.metricsName)
+		pool.DefaultExporter.Unregister(client.metricsName + ".master")
+	}
 	if client.pool != nil {
 		client.pool.Destory()
 	}
@@ -73,6 +131,25 @@ func (client *Client) Close() {
 	}
 }
 
+/**
+* 优雅关闭：拒绝新请求，等待使用中的连接归还，ctx结束时强制关闭
+**/
+func (client *Client) Shutdown(ctx context.Context) (err error) {
+	if client.metricsName != "" {
+		pool.DefaultExporter.Unregister(client.metricsName)
+		pool.DefaultExporter.Unregister(client.metricsName + ".master")
+	}
+	if client.pool != nil {
+		err = client.pool.Close(ctx)
+	}
+	if client.spool != nil {
+		if e := client.spool.Close(ctx); e != nil {
+			err = e
+		}
+	}
+	return
+}
+
 func (client *Client) Get(key string) (value []byte, err error) {
 	value, err = client.Do("GET", key)
 	return
@@ -84,7 +161,7 @@ func (client *Client) Set(key string, value []byte) (err error) {
 }
 
 func (client *Client) Lock(key string, expire_ms int) (token string, err error) {
-	token = string(rand.Int())
+	token = strconv.Itoa(rand.Int())
 	_, err = client.Do("SET", key, []byte(token), "PX", expire_ms, "NX")
 
 	return
@@ -103,87 +180,133 @@ func (client *Client) Unlock(key string, value string) (err error) {
 }
 
 func (client *Client) DoScript(scirpt *redislib.Script, args ...interface{}) (reply []byte, err error) {
-	// 耗时统计
+	return client.DoScriptContext(context.Background(), scirpt, args...)
+}
+
+/**
+* ctx用于控制获取连接的等待时间，并把其中的trace_id记录到redis_call日志
+ */
+func (client *Client) DoScriptContext(ctx context.Context, scirpt *redislib.Script, args ...interface{}) (reply []byte, err error) {
 	start := time.Now()
 	defer func() {
-		cost := time.Now().Sub(start)
-		errmsg := ""
-		if err != nil {
-			errmsg = err.Error()
-		}
-		log.Info(map[string]interface{}{
-			"action":  "redis_call",
-			"command": "DoScript",
-			"cost":    helper.FormatDurationToMs(cost),
-			"errmsg":  errmsg,
-		})
+		client.logCall(ctx, start, err, map[string]interface{}{"command": "DoScript"})
 	}()
 
-	pool := client.pool
-	if len(client.SentinelServers) > 0 {
-		pool = client.spool
-	}
-	conn, err := pool.Get()
-	if err != nil {
+	err = client.withConn(ctx, true, func(conn redislib.Conn) (e error) {
+		reply, e = redislib.Bytes(scirpt.Do(conn, args...))
 		return
-	}
-	defer pool.Release(conn)
-	redisConn, _ := conn.(redislib.Conn)
-	reply, err = redislib.Bytes(scirpt.Do(redisConn, args...))
+	})
 	return
 }
 
 func (client *Client) Do(commandName string, args ...interface{}) (reply []byte, err error) {
-	// 耗时统计
+	return client.DoContext(context.Background(), commandName, args...)
+}
+
+/**
+* ctx用于控制获取连接的等待时间，并把其中的trace_id记录到redis_call日志
+ */
+func (client *Client) DoContext(ctx context.Context, commandName string, args ...interface{}) (reply []byte, err error) {
+	return redislib.Bytes(client.do(ctx, commandName, args...))
+}
+
+/**
+* 未转换的回复，typed方法在此基础上转换
+ */
+func (client *Client) do(ctx context.Context, commandName string, args ...interface{}) (reply interface{}, err error) {
 	start := time.Now()
 	defer func() {
-		cost := time.Now().Sub(start)
-		errmsg := ""
-		if err != nil {
-			errmsg = err.Error()
-		}
-		log.Info(map[string]interface{}{
-			"action":  "redis_call",
-			"command": commandName,
-			"cost":    helper.FormatDurationToMs(cost),
-			"errmsg":  errmsg,
-		})
+		client.logCall(ctx, start, err, map[string]interface{}{"command": commandName})
 	}()
 
-	pool := client.pool
-	if isCommandWrite(commandName) && len(client.SentinelServers) > 0 {
-		pool = client.spool
+	err = client.withConn(ctx, isCommandWrite(commandName), func(conn redislib.Conn) (e error) {
+		reply, e = conn.Do(commandName, args...)
+		return
+	})
+	return
+}
+
+/**
+* 按读写选择连接池取一个连接执行fn，结束后归还
+* redigo在连接出现网络/协议错误后Err()不为nil，此时关闭连接而不是放回池子
+* fn panic时连接可能还有未读的回复或处于WATCH/MULTI状态，同样关闭
+ */
+func (client *Client) withConn(ctx context.Context, write bool, fn func(conn redislib.Conn) error) error {
+	pool := client.getPool(write)
+	conn, err := pool.GetContext(ctx)
+	if err != nil {
+		return err
 	}
-	conn, err := pool.Get()
+	finished := false
+	defer func() {
+		if !finished {
+			pool.PutWithError(conn, errConnAborted)
+			return
+		}
+		pool.PutWithError(conn, conn.Err())
+	}()
+	err = fn(conn)
+	finished = true
+	return err
+}
+
+/**
+* 耗时统计，记录redis_call日志，fields为command等额外字段
+ */
+func (client *Client) logCall(ctx context.Context, start time.Time, err error, fields map[string]interface{}) {
+	cost := time.Now().Sub(start)
+	errmsg := ""
 	if err != nil {
-		return
+		errmsg = err.Error()
 	}
-	defer pool.Release(conn)
-	redisConn, _ := conn.(redislib.Conn)
-	reply, err = redislib.Bytes(redisConn.Do(commandName, args...))
-	return
+	fields["action"] = "redis_call"
+	fields["cost"] = helper.FormatDurationToMs(cost)
+	fields["errmsg"] = errmsg
+	client.logger().WithContext(ctx).Info(fields)
 }
 
 func (client *Client) initPool() {
 
-	rand_gen := rand.New(rand.NewSource(time.Now().UnixNano()))
+	endpoints := make([]pool.Endpoint, len(client.Servers))
+	weights := make(map[string]int, len(client.Servers))
+	totalWeight := 0
+	for i, server := range client.Servers {
+		endpoints[i].Addr = server
+		weight := 1
+		if i < len(client.Weights) && client.Weights[i] > 0 {
+			weight = client.Weights[i]
+		}
+		endpoints[i].Weight = weight
+		weights[server] = weight
+		totalWeight += weight
+	}
 
-	client.pool = pool.New(
-		client.MaxIdle,
-		client.MaxActive,
-		client.IdleTimeoutS,
-		func() (pool.Conn, error) {
-			index := rand_gen.Intn(len(client.Servers))
-			redisConn, err := client.DialConn(client.Servers[index])
-			return redisConn, err
-		},
-		func(c pool.Conn) error {
-			conn, _ := c.(redislib.Conn)
+	// 连接数配置为整个client的总数，与单连接池时一致，按权重分到各个server
+	client.pool = pool.NewMultiPool(endpoints, func(addr string) *pool.Pool[redislib.Conn] {
+		weight := weights[addr]
+		p := pool.NewPool(
+			splitByWeight(client.MaxIdle, weight, totalWeight),
+			splitByWeight(client.MaxActive, weight, totalWeight),
+			client.IdleTimeoutS,
+			func() (redislib.Conn, error) {
+				return client.DialConn(addr)
+			},
+			true,
+		)
+		p.OnBorrow = func(conn redislib.Conn) error {
 			_, err := conn.Do("PING")
 			return err
-		},
-		true,
-	)
+		}
+		client.setupPool(p, splitByWeight(client.MinIdle, weight, totalWeight))
+		return p
+	})
+	switch strings.ToLower(client.Balance) {
+	case "roundrobin":
+		client.pool.Balance = pool.BalanceRoundRobin
+	case "leastconn":
+		client.pool.Balance = pool.BalanceLeastConn
+	}
+	client.pool.StartProbe(0)
 }
 
 func (client *Client) initSentinelpool() {
@@ -198,25 +321,64 @@ func (client *Client) initSentinelpool() {
 		},
 	}
 
-	client.spool = pool.New(
+	client.spool = pool.NewPool(
 		client.MaxIdle,
 		client.MaxActive,
 		client.IdleTimeoutS,
-		func() (pool.Conn, error) {
+		func() (redislib.Conn, error) {
 			master, err := stnl.MasterAddr()
-			redisConn, err := client.DialConn(master)
-			return redisConn, err
-		},
-		func(c pool.Conn) error {
-			conn, _ := c.(redislib.Conn)
-			if !sentinel.TestRole(conn, "master") {
-				return errors.New("Failed role check")
-			} else {
-				return nil
+			if err != nil {
+				return nil, err
 			}
+			return client.DialConn(master)
 		},
 		true,
 	)
+	client.spool.OnBorrow = func(conn redislib.Conn) error {
+		if !sentinel.TestRole(conn, "master") {
+			return errors.New("Failed role check")
+		}
+		return nil
+	}
+	client.setupPool(client.spool, client.MinIdle)
+}
+
+/**
+* server按权重分到的连接数，向上取整，至少1，total<=0(不限制)时不变
+ */
+func splitByWeight(total int, weight int, totalWeight int) int {
+	if total <= 0 || totalWeight <= 0 {
+		return total
+	}
+	n := (total*weight + totalWeight - 1) / totalWeight
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+/**
+* 设置New之外的连接池参数，预热并启动后台回收
+ */
+func (client *Client) setupPool(p *pool.Pool[redislib.Conn], minIdle int) {
+	p.WaitTimeoutMs = client.WaitTimeoutMs
+	p.MaxLifetimeS = client.MaxLifetimeS
+	p.MinIdle = minIdle
+	if strings.ToLower(client.IdleStrategy) == "fifo" {
+		p.IdleStrategy = pool.IdleFIFO
+	}
+	p.OnWarmError = func(err error) {
+		client.logger().Warning(map[string]interface{}{
+			"action": "redis_warm",
+			"errmsg": err.Error(),
+		})
+	}
+	if minIdle > 0 {
+		p.Warm()
+	}
+	if client.IdleTimeoutS > 0 || client.MaxLifetimeS > 0 || minIdle > 0 {
+		p.StartReaper(0)
+	}
 }
 
 /**
@@ -228,6 +390,9 @@ func (client *Client) DialConn(address string) (redislib.Conn, error) {
 		address,
 		time.Duration(client.ConnTimeoutMs)*time.Millisecond,
 	)
+	if err != nil {
+		return nil, err
+	}
 	redisConn := redislib.NewConn(
 		netConn,
 		time.Duration(client.ReadTimeoutMs)*time.Millisecond,
@@ -1,6 +1,7 @@
 package redis
 
 import (
+	"context"
 	"fmt"
 	"testing"
 )
@@ -48,3 +49,128 @@ func TestSentinel(t *testing.T) {
 		"err":    err,
 	})
 }
+
+/**
+* pipeline批量读写
+ */
+func TestPipeline(t *testing.T) {
+
+	redisClient, err := Init("../../conf/redis.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := redisClient["order"].Pipeline()
+	p.Send("SET", "test_key3", "hello")
+	p.Send("HGET", "test_key3", "field")
+	p.Send("GET", "test_key3")
+	results, err := p.Exec()
+	if err == nil || len(results) != 3 {
+		t.Fatalf("expect WRONGTYPE error, got %v %v", results, err)
+	}
+	if results[0].Err != nil || results[1].Err == nil || results[2].Err != nil || string(results[2].Reply.([]byte)) != "hello" {
+		t.Fatalf("unexpected results %v", results)
+	}
+	if p.Len() != 0 {
+		t.Fatalf("expect empty pipeline after Exec, got %d", p.Len())
+	}
+}
+
+/**
+* watch乐观锁事务
+ */
+func TestWatch(t *testing.T) {
+
+	redisClient, err := Init("../../conf/redis.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redisClient["order"]
+	client.Set("test_key4", []byte("1"))
+
+	attempts := 0
+	replies, err := client.Watch([]string{"test_key4"}, func(tx *Tx) error {
+		attempts++
+		if attempts == 1 {
+			// 其他连接修改watch的key，第一次EXEC冲突
+			client.Set("test_key4", []byte("2"))
+		}
+		value, err := tx.Do("GET", "test_key4")
+		if err != nil {
+			return err
+		}
+		tx.Send("SET", "test_key4", append(value.([]byte), '0'))
+		return nil
+	})
+	if err != nil || attempts != 2 || len(replies) != 1 {
+		t.Fatalf("unexpected watch result %v %v attempts=%d", replies, err, attempts)
+	}
+	value, err := client.Get("test_key4")
+	if err != nil || string(value) != "20" {
+		t.Fatalf("expect 20, got %s %v", value, err)
+	}
+}
+
+/**
+* 带类型的命令
+ */
+func TestTypedCommands(t *testing.T) {
+
+	redisClient, err := Init("../../conf/redis.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redisClient["order"]
+	client.Del("test_key5", "test_key6", "test_key7")
+
+	if n, err := client.Incr("test_key5"); err != nil || n != 1 {
+		t.Fatalf("expect 1, got %d %v", n, err)
+	}
+	if ok, err := client.Expire("test_key5", 60); err != nil || !ok {
+		t.Fatalf("expect expire ok, got %v %v", ok, err)
+	}
+	if ttl, err := client.TTL("test_key5"); err != nil || ttl <= 0 || ttl > 60 {
+		t.Fatalf("unexpected ttl %d %v", ttl, err)
+	}
+	if ok, err := client.Exists("test_key6"); err != nil || ok {
+		t.Fatalf("expect not exists, got %v %v", ok, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.ExistsContext(ctx, "test_key6"); err != context.Canceled {
+		t.Fatalf("expect context canceled, got %v", err)
+	}
+
+	client.HMSet("test_key6", map[string]interface{}{"a": 1, "b": "x"})
+	if m, err := client.HGetAll("test_key6"); err != nil || m["a"] != "1" || m["b"] != "x" {
+		t.Fatalf("unexpected hash %v %v", m, err)
+	}
+	if _, err := client.HGet("test_key6", "c"); err != ErrNil {
+		t.Fatalf("expect ErrNil, got %v", err)
+	}
+
+	client.ZAdd("test_key7", ScoredMember{Member: "m1", Score: 1.5}, ScoredMember{Member: "m2", Score: 0.5})
+	members, err := client.ZRangeWithScores("test_key7", 0, -1)
+	if err != nil || len(members) != 2 || members[0].Member != "m2" || members[1].Score != 1.5 {
+		t.Fatalf("unexpected members %v %v", members, err)
+	}
+
+	_, keys, err := client.Scan(0, "test_key*", 100)
+	fmt.Println(map[string]interface{}{
+		"action": "scan",
+		"keys":   keys,
+		"err":    err,
+	})
+	client.Del("test_key5", "test_key6", "test_key7")
+}
+
+/**
+* 整个client的连接数按权重分到各个server
+ */
+func TestSplitByWeight(t *testing.T) {
+	// MaxActive 200，权重1:1各100，1:2为67/134，不限制时不变
+	for _, c := range [][4]int{{200, 1, 2, 100}, {200, 1, 3, 67}, {200, 2, 3, 134}, {1, 1, 3, 1}, {0, 1, 2, 0}} {
+		if n := splitByWeight(c[0], c[1], c[2]); n != c[3] {
+			t.Fatalf("splitByWeight(%d, %d, %d) expect %d, got %d", c[0], c[1], c[2], c[3], n)
+		}
+	}
+}
@@ -0,0 +1,464 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	redislib "github.com/gomodule/redigo/redis"
+)
+
+/**
+* 常用命令，回复转换为对应类型，key/field不存在时返回ErrNil的命令已注明
+* 每个命令都有XxxContext版本，ctx用于控制获取连接的等待时间，并把其中的trace_id记录到redis_call日志
+ */
+
+func (client *Client) Del(keys ...string) (int64, error) {
+	return client.DelContext(context.Background(), keys...)
+}
+
+func (client *Client) DelContext(ctx context.Context, keys ...string) (int64, error) {
+	return client.Int64Context(ctx, "DEL", stringArgs(keys)...)
+}
+
+func (client *Client) Exists(key string) (bool, error) {
+	return client.ExistsContext(context.Background(), key)
+}
+
+func (client *Client) ExistsContext(ctx context.Context, key string) (bool, error) {
+	return client.BoolContext(ctx, "EXISTS", key)
+}
+
+func (client *Client) Incr(key string) (int64, error) {
+	return client.IncrContext(context.Background(), key)
+}
+
+func (client *Client) IncrContext(ctx context.Context, key string) (int64, error) {
+	return client.Int64Context(ctx, "INCR", key)
+}
+
+func (client *Client) IncrBy(key string, increment int64) (int64, error) {
+	return client.IncrByContext(context.Background(), key, increment)
+}
+
+func (client *Client) IncrByContext(ctx context.Context, key string, increment int64) (int64, error) {
+	return client.Int64Context(ctx, "INCRBY", key, increment)
+}
+
+/**
+* key不存在时返回false
+ */
+func (client *Client) Expire(key string, expireS int) (bool, error) {
+	return client.ExpireContext(context.Background(), key, expireS)
+}
+
+func (client *Client) ExpireContext(ctx context.Context, key string, expireS int) (bool, error) {
+	return client.BoolContext(ctx, "EXPIRE", key, expireS)
+}
+
+func (client *Client) PExpire(key string, expireMs int64) (bool, error) {
+	return client.PExpireContext(context.Background(), key, expireMs)
+}
+
+func (client *Client) PExpireContext(ctx context.Context, key string, expireMs int64) (bool, error) {
+	return client.BoolContext(ctx, "PEXPIRE", key, expireMs)
+}
+
+/**
+* timestamp为unix时间戳，单位秒
+ */
+func (client *Client) ExpireAt(key string, timestamp int64) (bool, error) {
+	return client.ExpireAtContext(context.Background(), key, timestamp)
+}
+
+func (client *Client) ExpireAtContext(ctx context.Context, key string, timestamp int64) (bool, error) {
+	return client.BoolContext(ctx, "EXPIREAT", key, timestamp)
+}
+
+func (client *Client) Persist(key string) (bool, error) {
+	return client.PersistContext(context.Background(), key)
+}
+
+func (client *Client) PersistContext(ctx context.Context, key string) (bool, error) {
+	return client.BoolContext(ctx, "PERSIST", key)
+}
+
+/**
+* 剩余秒数，key不存在返回-2，没有过期时间返回-1
+ */
+func (client *Client) TTL(key string) (int64, error) {
+	return client.TTLContext(context.Background(), key)
+}
+
+func (client *Client) TTLContext(ctx context.Context, key string) (int64, error) {
+	return client.Int64Context(ctx, "TTL", key)
+}
+
+/**
+* 剩余毫秒数，key不存在返回-2，没有过期时间返回-1
+ */
+func (client *Client) PTTL(key string) (int64, error) {
+	return client.PTTLContext(context.Background(), key)
+}
+
+func (client *Client) PTTLContext(ctx context.Context, key string) (int64, error) {
+	return client.Int64Context(ctx, "PTTL", key)
+}
+
+/**
+* 增量遍历key，match为空时不过滤，返回的cursor为0表示遍历结束
+ */
+func (client *Client) Scan(cursor uint64, match string, count int) (next uint64, keys []string, err error) {
+	return client.ScanContext(context.Background(), cursor, match, count)
+}
+
+func (client *Client) ScanContext(ctx context.Context, cursor uint64, match string, count int) (next uint64, keys []string, err error) {
+	args := []interface{}{cursor}
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	if count > 0 {
+		args = append(args, "COUNT", count)
+	}
+	values, err := client.ValuesContext(ctx, "SCAN", args...)
+	if err != nil {
+		return
+	}
+	if len(values) != 2 {
+		err = errors.New("redis: unexpected SCAN reply")
+		return
+	}
+	if next, err = redislib.Uint64(values[0], nil); err != nil {
+		return
+	}
+	keys, err = redislib.Strings(values[1], nil)
+	return
+}
+
+/**
+* field不存在时返回ErrNil
+ */
+func (client *Client) HGet(key string, field string) (string, error) {
+	return client.HGetContext(context.Background(), key, field)
+}
+
+func (client *Client) HGetContext(ctx context.Context, key string, field string) (string, error) {
+	return client.StringReplyContext(ctx, "HGET", key, field)
+}
+
+/**
+* 返回新增的field数
+ */
+func (client *Client) HSet(key string, field string, value interface{}) (int64, error) {
+	return client.HSetContext(context.Background(), key, field, value)
+}
+
+func (client *Client) HSetContext(ctx context.Context, key string, field string, value interface{}) (int64, error) {
+	return client.Int64Context(ctx, "HSET", key, field, value)
+}
+
+func (client *Client) HMSet(key string, fields map[string]interface{}) error {
+	return client.HMSetContext(context.Background(), key, fields)
+}
+
+func (client *Client) HMSetContext(ctx context.Context, key string, fields map[string]interface{}) (err error) {
+	args := make([]interface{}, 0, 1+len(fields)*2)
+	args = append(args, key)
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+	_, err = client.do(ctx, "HMSET", args...)
+	return
+}
+
+/**
+* 与fields一一对应，不存在的field为空串
+ */
+func (client *Client) HMGet(key string, fields ...string) ([]string, error) {
+	return client.HMGetContext(context.Background(), key, fields...)
+}
+
+func (client *Client) HMGetContext(ctx context.Context, key string, fields ...string) ([]string, error) {
+	return client.StringsContext(ctx, "HMGET", keyArgs(key, fields)...)
+}
+
+func (client *Client) HGetAll(key string) (map[string]string, error) {
+	return client.HGetAllContext(context.Background(), key)
+}
+
+func (client *Client) HGetAllContext(ctx context.Context, key string) (map[string]string, error) {
+	return client.StringMapContext(ctx, "HGETALL", key)
+}
+
+func (client *Client) HDel(key string, fields ...string) (int64, error) {
+	return client.HDelContext(context.Background(), key, fields...)
+}
+
+func (client *Client) HDelContext(ctx context.Context, key string, fields ...string) (int64, error) {
+	return client.Int64Context(ctx, "HDEL", keyArgs(key, fields)...)
+}
+
+func (client *Client) HExists(key string, field string) (bool, error) {
+	return client.HExistsContext(context.Background(), key, field)
+}
+
+func (client *Client) HExistsContext(ctx context.Context, key string, field string) (bool, error) {
+	return client.BoolContext(ctx, "HEXISTS", key, field)
+}
+
+func (client *Client) HIncrBy(key string, field string, increment int64) (int64, error) {
+	return client.HIncrByContext(context.Background(), key, field, increment)
+}
+
+func (client *Client) HIncrByContext(ctx context.Context, key string, field string, increment int64) (int64, error) {
+	return client.Int64Context(ctx, "HINCRBY", key, field, increment)
+}
+
+func (client *Client) HLen(key string) (int64, error) {
+	return client.HLenContext(context.Background(), key)
+}
+
+func (client *Client) HLenContext(ctx context.Context, key string) (int64, error) {
+	return client.Int64Context(ctx, "HLEN", key)
+}
+
+func (client *Client) HKeys(key string) ([]string, error) {
+	return client.HKeysContext(context.Background(), key)
+}
+
+func (client *Client) HKeysContext(ctx context.Context, key string) ([]string, error) {
+	return client.StringsContext(ctx, "HKEYS", key)
+}
+
+/**
+* 返回push后的列表长度
+ */
+func (client *Client) LPush(key string, values ...interface{}) (int64, error) {
+	return client.LPushContext(context.Background(), key, values...)
+}
+
+func (client *Client) LPushContext(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return client.Int64Context(ctx, "LPUSH", append([]interface{}{key}, values...)...)
+}
+
+func (client *Client) RPush(key string, values ...interface{}) (int64, error) {
+	return client.RPushContext(context.Background(), key, values...)
+}
+
+func (client *Client) RPushContext(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return client.Int64Context(ctx, "RPUSH", append([]interface{}{key}, values...)...)
+}
+
+/**
+* 列表为空时返回ErrNil
+ */
+func (client *Client) LPop(key string) (string, error) {
+	return client.LPopContext(context.Background(), key)
+}
+
+func (client *Client) LPopContext(ctx context.Context, key string) (string, error) {
+	return client.StringReplyContext(ctx, "LPOP", key)
+}
+
+func (client *Client) RPop(key string) (string, error) {
+	return client.RPopContext(context.Background(), key)
+}
+
+func (client *Client) RPopContext(ctx context.Context, key string) (string, error) {
+	return client.StringReplyContext(ctx, "RPOP", key)
+}
+
+/**
+* start/stop含两端，-1表示最后一个
+ */
+func (client *Client) LRange(key string, start int64, stop int64) ([]string, error) {
+	return client.LRangeContext(context.Background(), key, start, stop)
+}
+
+func (client *Client) LRangeContext(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	return client.StringsContext(ctx, "LRANGE", key, start, stop)
+}
+
+func (client *Client) LLen(key string) (int64, error) {
+	return client.LLenContext(context.Background(), key)
+}
+
+func (client *Client) LLenContext(ctx context.Context, key string) (int64, error) {
+	return client.Int64Context(ctx, "LLEN", key)
+}
+
+func (client *Client) LTrim(key string, start int64, stop int64) error {
+	return client.LTrimContext(context.Background(), key, start, stop)
+}
+
+func (client *Client) LTrimContext(ctx context.Context, key string, start int64, stop int64) (err error) {
+	_, err = client.do(ctx, "LTRIM", key, start, stop)
+	return
+}
+
+/**
+* 返回新增的成员数
+ */
+func (client *Client) SAdd(key string, members ...interface{}) (int64, error) {
+	return client.SAddContext(context.Background(), key, members...)
+}
+
+func (client *Client) SAddContext(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return client.Int64Context(ctx, "SADD", append([]interface{}{key}, members...)...)
+}
+
+func (client *Client) SRem(key string, members ...interface{}) (int64, error) {
+	return client.SRemContext(context.Background(), key, members...)
+}
+
+func (client *Client) SRemContext(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return client.Int64Context(ctx, "SREM", append([]interface{}{key}, members...)...)
+}
+
+func (client *Client) SMembers(key string) ([]string, error) {
+	return client.SMembersContext(context.Background(), key)
+}
+
+func (client *Client) SMembersContext(ctx context.Context, key string) ([]string, error) {
+	return client.StringsContext(ctx, "SMEMBERS", key)
+}
+
+func (client *Client) SIsMember(key string, member interface{}) (bool, error) {
+	return client.SIsMemberContext(context.Background(), key, member)
+}
+
+func (client *Client) SIsMemberContext(ctx context.Context, key string, member interface{}) (bool, error) {
+	return client.BoolContext(ctx, "SISMEMBER", key, member)
+}
+
+func (client *Client) SCard(key string) (int64, error) {
+	return client.SCardContext(context.Background(), key)
+}
+
+func (client *Client) SCardContext(ctx context.Context, key string) (int64, error) {
+	return client.Int64Context(ctx, "SCARD", key)
+}
+
+/**
+* 返回新增的成员数，已存在的成员更新分数
+ */
+func (client *Client) ZAdd(key string, members ...ScoredMember) (int64, error) {
+	return client.ZAddContext(context.Background(), key, members...)
+}
+
+func (client *Client) ZAddContext(ctx context.Context, key string, members ...ScoredMember) (int64, error) {
+	args := make([]interface{}, 0, 1+len(members)*2)
+	args = append(args, key)
+	for _, m := range members {
+		args = append(args, m.Score, m.Member)
+	}
+	return client.Int64Context(ctx, "ZADD", args...)
+}
+
+/**
+* 返回新的分数
+ */
+func (client *Client) ZIncrBy(key string, increment float64, member string) (float64, error) {
+	return client.ZIncrByContext(context.Background(), key, increment, member)
+}
+
+func (client *Client) ZIncrByContext(ctx context.Context, key string, increment float64, member string) (float64, error) {
+	return client.FloatContext(ctx, "ZINCRBY", key, increment, member)
+}
+
+func (client *Client) ZRem(key string, members ...string) (int64, error) {
+	return client.ZRemContext(context.Background(), key, members...)
+}
+
+func (client *Client) ZRemContext(ctx context.Context, key string, members ...string) (int64, error) {
+	return client.Int64Context(ctx, "ZREM", keyArgs(key, members)...)
+}
+
+/**
+* 成员不存在时返回ErrNil
+ */
+func (client *Client) ZScore(key string, member string) (float64, error) {
+	return client.ZScoreContext(context.Background(), key, member)
+}
+
+func (client *Client) ZScoreContext(ctx context.Context, key string, member string) (float64, error) {
+	return client.FloatContext(ctx, "ZSCORE", key, member)
+}
+
+/**
+* 从0开始的排名，成员不存在时返回ErrNil
+ */
+func (client *Client) ZRank(key string, member string) (int64, error) {
+	return client.ZRankContext(context.Background(), key, member)
+}
+
+func (client *Client) ZRankContext(ctx context.Context, key string, member string) (int64, error) {
+	return client.Int64Context(ctx, "ZRANK", key, member)
+}
+
+func (client *Client) ZCard(key string) (int64, error) {
+	return client.ZCardContext(context.Background(), key)
+}
+
+func (client *Client) ZCardContext(ctx context.Context, key string) (int64, error) {
+	return client.Int64Context(ctx, "ZCARD", key)
+}
+
+/**
+* 按分数从小到大，start/stop含两端，-1表示最后一个
+ */
+func (client *Client) ZRange(key string, start int64, stop int64) ([]string, error) {
+	return client.ZRangeContext(context.Background(), key, start, stop)
+}
+
+func (client *Client) ZRangeContext(ctx context.Context, key string, start int64, stop int64) ([]string, error) {
+	return client.StringsContext(ctx, "ZRANGE", key, start, stop)
+}
+
+func (client *Client) ZRangeWithScores(key string, start int64, stop int64) ([]ScoredMember, error) {
+	return client.ZRangeWithScoresContext(context.Background(), key, start, stop)
+}
+
+func (client *Client) ZRangeWithScoresContext(ctx context.Context, key string, start int64, stop int64) ([]ScoredMember, error) {
+	return client.ScoredMembersContext(ctx, "ZRANGE", key, start, stop, "WITHSCORES")
+}
+
+func (client *Client) ZRevRangeWithScores(key string, start int64, stop int64) ([]ScoredMember, error) {
+	return client.ZRevRangeWithScoresContext(context.Background(), key, start, stop)
+}
+
+func (client *Client) ZRevRangeWithScoresContext(ctx context.Context, key string, start int64, stop int64) ([]ScoredMember, error) {
+	return client.ScoredMembersContext(ctx, "ZREVRANGE", key, start, stop, "WITHSCORES")
+}
+
+/**
+* min/max同ZRANGEBYSCORE，如 "-inf"、"(1.5"
+ */
+func (client *Client) ZRangeByScoreWithScores(key string, min string, max string) ([]ScoredMember, error) {
+	return client.ZRangeByScoreWithScoresContext(context.Background(), key, min, max)
+}
+
+func (client *Client) ZRangeByScoreWithScoresContext(ctx context.Context, key string, min string, max string) ([]ScoredMember, error) {
+	return client.ScoredMembersContext(ctx, "ZRANGEBYSCORE", key, min, max, "WITHSCORES")
+}
+
+/**
+* 返回删除的成员数
+ */
+func (client *Client) ZRemRangeByScore(key string, min string, max string) (int64, error) {
+	return client.ZRemRangeByScoreContext(context.Background(), key, min, max)
+}
+
+func (client *Client) ZRemRangeByScoreContext(ctx context.Context, key string, min string, max string) (int64, error) {
+	return client.Int64Context(ctx, "ZREMRANGEBYSCORE", key, min, max)
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
+
+func keyArgs(key string, values []string) []interface{} {
+	return append([]interface{}{key}, stringArgs(values)...)
+}
@@ -0,0 +1,117 @@
+package redis
+
+import (
+	"context"
+	redislib "github.com/gomodule/redigo/redis"
+	"time"
+)
+
+// Pipeline 批量命令，Send只在本地排队，Exec时在同一个连接上一次性发送并按顺序读取全部回复
+// 不是并发安全的，Exec后清空可继续使用
+type Pipeline struct {
+	client *Client
+	cmds   []pipelineCommand
+}
+
+type pipelineCommand struct {
+	name string
+	args []interface{}
+}
+
+// PipelineResult 单个命令的回复，Err为该命令的错误(redis返回的错误或连接错误)
+type PipelineResult struct {
+	Reply interface{}
+	Err   error
+}
+
+func (client *Client) Pipeline() *Pipeline {
+	return &Pipeline{client: client}
+}
+
+/**
+* 排队一个命令，Exec时才发送
+ */
+func (p *Pipeline) Send(commandName string, args ...interface{}) {
+	p.cmds = append(p.cmds, pipelineCommand{name: commandName, args: args})
+}
+
+/**
+* 已排队的命令数
+ */
+func (p *Pipeline) Len() int {
+	return len(p.cmds)
+}
+
+func (p *Pipeline) Exec() ([]PipelineResult, error) {
+	return p.ExecContext(context.Background())
+}
+
+/**
+* 返回与Send顺序一致的回复，err为第一个出错命令的错误
+* 包含写命令时与Do一样在sentinel模式下使用master连接池
+* 连接出错时后续命令的Err均为该错误，未取到连接时results为nil
+ */
+func (p *Pipeline) ExecContext(ctx context.Context) (results []PipelineResult, err error) {
+	cmds := p.cmds
+	p.cmds = nil
+	if len(cmds) == 0 {
+		return nil, nil
+	}
+	client := p.client
+
+	start := time.Now()
+	defer func() {
+		client.logCall(ctx, start, err, map[string]interface{}{"command": "PIPELINE", "count": len(cmds)})
+	}()
+
+	write := false
+	for _, cmd := range cmds {
+		if isCommandWrite(cmd.name) {
+			write = true
+			break
+		}
+	}
+	err = client.withConn(ctx, write, func(conn redislib.Conn) error {
+		results = make([]PipelineResult, len(cmds))
+		return exec(conn, cmds, results)
+	})
+	return
+}
+
+/**
+* 发送全部命令后按顺序读取回复，返回第一个出错命令的错误
+ */
+func exec(conn redislib.Conn, cmds []pipelineCommand, results []PipelineResult) (err error) {
+	for _, cmd := range cmds {
+		if err = conn.Send(cmd.name, cmd.args...); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = conn.Flush()
+	}
+	if err != nil {
+		for i := range results {
+			results[i].Err = err
+		}
+		return
+	}
+
+	for i := range results {
+		results[i].Reply, results[i].Err = conn.Receive()
+		if results[i].Err == nil {
+			continue
+		}
+		if err == nil {
+			err = results[i].Err
+		}
+		if _, ok := results[i].Err.(redislib.Error); !ok {
+			// 连接已不可用，剩余回复无法读取
+			for j := i + 1; j < len(results); j++ {
+				results[j].Err = results[i].Err
+			}
+			return
+		}
+	}
+	return
+}
@@ -138,7 +138,7 @@ var redisCommandTable = map[string]RedisCommand{
 	"lastsave":          {sflags: "rRF"},
 	"type":              {sflags: "rF"},
 	"multi":             {sflags: "rsF"},
-	"exec":              {sflags: "sM"},
+	"exec":              {sflags: "wsM"},
 	"discard":           {sflags: "rsF"},
 	"sync":              {sflags: "ars"},
 	"psync":             {sflags: "ars"},
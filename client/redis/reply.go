@@ -0,0 +1,118 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	redislib "github.com/gomodule/redigo/redis"
+	"strconv"
+)
+
+// 回复为nil(key或field不存在)，调用方无需引入redigo即可判断
+var ErrNil = redislib.ErrNil
+
+// ScoredMember ZRANGE WITHSCORES等返回的成员与分数
+type ScoredMember struct {
+	Member string
+	Score  float64
+}
+
+/**
+* 以下方法执行命令并转换回复类型，日志与连接池选择同Do，XxxContext同DoContext
+ */
+func (client *Client) Int64(commandName string, args ...interface{}) (int64, error) {
+	return client.Int64Context(context.Background(), commandName, args...)
+}
+
+func (client *Client) Int64Context(ctx context.Context, commandName string, args ...interface{}) (int64, error) {
+	return redislib.Int64(client.do(ctx, commandName, args...))
+}
+
+func (client *Client) StringReply(commandName string, args ...interface{}) (string, error) {
+	return client.StringReplyContext(context.Background(), commandName, args...)
+}
+
+func (client *Client) StringReplyContext(ctx context.Context, commandName string, args ...interface{}) (string, error) {
+	return redislib.String(client.do(ctx, commandName, args...))
+}
+
+/**
+* 数组回复，nil元素转为空串
+ */
+func (client *Client) Strings(commandName string, args ...interface{}) ([]string, error) {
+	return client.StringsContext(context.Background(), commandName, args...)
+}
+
+func (client *Client) StringsContext(ctx context.Context, commandName string, args ...interface{}) ([]string, error) {
+	return redislib.Strings(client.do(ctx, commandName, args...))
+}
+
+/**
+* field/value交替的数组回复，如HGETALL
+ */
+func (client *Client) StringMap(commandName string, args ...interface{}) (map[string]string, error) {
+	return client.StringMapContext(context.Background(), commandName, args...)
+}
+
+func (client *Client) StringMapContext(ctx context.Context, commandName string, args ...interface{}) (map[string]string, error) {
+	return redislib.StringMap(client.do(ctx, commandName, args...))
+}
+
+func (client *Client) Float(commandName string, args ...interface{}) (float64, error) {
+	return client.FloatContext(context.Background(), commandName, args...)
+}
+
+func (client *Client) FloatContext(ctx context.Context, commandName string, args ...interface{}) (float64, error) {
+	return redislib.Float64(client.do(ctx, commandName, args...))
+}
+
+/**
+* 整数回复非0为true，如EXISTS/SISMEMBER/EXPIRE
+ */
+func (client *Client) Bool(commandName string, args ...interface{}) (bool, error) {
+	return client.BoolContext(context.Background(), commandName, args...)
+}
+
+func (client *Client) BoolContext(ctx context.Context, commandName string, args ...interface{}) (bool, error) {
+	return redislib.Bool(client.do(ctx, commandName, args...))
+}
+
+/**
+* 嵌套数组等其他回复，如SCAN
+ */
+func (client *Client) Values(commandName string, args ...interface{}) ([]interface{}, error) {
+	return client.ValuesContext(context.Background(), commandName, args...)
+}
+
+func (client *Client) ValuesContext(ctx context.Context, commandName string, args ...interface{}) ([]interface{}, error) {
+	return redislib.Values(client.do(ctx, commandName, args...))
+}
+
+/**
+* member/score交替的数组回复，如ZRANGE WITHSCORES
+ */
+func (client *Client) ScoredMembers(commandName string, args ...interface{}) ([]ScoredMember, error) {
+	return client.ScoredMembersContext(context.Background(), commandName, args...)
+}
+
+func (client *Client) ScoredMembersContext(ctx context.Context, commandName string, args ...interface{}) ([]ScoredMember, error) {
+	return scoredMembers(client.do(ctx, commandName, args...))
+}
+
+func scoredMembers(reply interface{}, err error) ([]ScoredMember, error) {
+	values, err := redislib.Strings(reply, err)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, errors.New("redis: ScoredMembers expects even number of values")
+	}
+	members := make([]ScoredMember, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		score, err := strconv.ParseFloat(values[i+1], 64)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, ScoredMember{Member: values[i], Score: score})
+	}
+	return members, nil
+}
@@ -0,0 +1,108 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	redislib "github.com/gomodule/redigo/redis"
+	"strings"
+	"time"
+)
+
+const DEFAULT_WATCH_RETRIES int = 3
+
+// 重试后watch的key仍被其他客户端修改
+var ErrTxConflict = errors.New("redis: transaction conflict, watched keys changed")
+
+// Tx Watch回调中使用的事务，Do在固定的连接上立即执行(读取watch的key)，Send排队到MULTI/EXEC中执行
+type Tx struct {
+	conn redislib.Conn
+	cmds []pipelineCommand
+}
+
+/**
+* 立即执行，用于在MULTI前读取watch的key
+ */
+func (tx *Tx) Do(commandName string, args ...interface{}) (reply interface{}, err error) {
+	return tx.conn.Do(commandName, args...)
+}
+
+/**
+* 排队一个命令，回调返回后在MULTI/EXEC中执行
+ */
+func (tx *Tx) Send(commandName string, args ...interface{}) {
+	tx.cmds = append(tx.cmds, pipelineCommand{name: commandName, args: args})
+}
+
+func (client *Client) Watch(keys []string, fn func(tx *Tx) error) ([]interface{}, error) {
+	return client.WatchContext(context.Background(), keys, fn)
+}
+
+/**
+* 乐观锁事务：在同一个master连接上 WATCH keys -> fn -> MULTI -> Send的命令 -> EXEC
+* EXEC返回nil(watch的key被修改)时重新执行fn，最多重试WatchRetries次，仍冲突返回ErrTxConflict
+* fn返回错误或没有Send命令时UNWATCH后返回，不执行事务
+* 返回EXEC中每个命令的回复
+ */
+func (client *Client) WatchContext(ctx context.Context, keys []string, fn func(tx *Tx) error) (replies []interface{}, err error) {
+	retries := client.WatchRetries
+	if retries <= 0 {
+		retries = DEFAULT_WATCH_RETRIES
+	}
+	args := stringArgs(keys)
+
+	err = client.withConn(ctx, true, func(conn redislib.Conn) (e error) {
+		for attempt := 1; attempt <= retries+1; attempt++ {
+			if e = ctx.Err(); e != nil {
+				return
+			}
+			var done bool
+			replies, done, e = client.watchOnce(ctx, conn, keys, args, attempt, fn)
+			if done {
+				return
+			}
+		}
+		return
+	})
+	return
+}
+
+/**
+* 执行一次事务，done为false表示EXEC冲突需要重试
+ */
+func (client *Client) watchOnce(ctx context.Context, conn redislib.Conn, keys []string, args []interface{},
+	attempt int, fn func(tx *Tx) error) (replies []interface{}, done bool, err error) {
+
+	start := time.Now()
+	defer func() {
+		client.logCall(ctx, start, err, map[string]interface{}{
+			"command": "WATCH",
+			"keys":    strings.Join(keys, ","),
+			"attempt": attempt,
+		})
+	}()
+
+	if _, err = conn.Do("WATCH", args...); err != nil {
+		return nil, true, err
+	}
+	tx := &Tx{conn: conn}
+	if err = fn(tx); err != nil || len(tx.cmds) == 0 {
+		if _, e := conn.Do("UNWATCH"); err == nil {
+			err = e
+		}
+		return nil, true, err
+	}
+
+	conn.Send("MULTI")
+	for _, cmd := range tx.cmds {
+		conn.Send(cmd.name, cmd.args...)
+	}
+	reply, err := conn.Do("EXEC")
+	if err != nil {
+		return nil, true, err
+	}
+	if reply == nil {
+		return nil, false, ErrTxConflict
+	}
+	replies, err = redislib.Values(reply, nil)
+	return replies, true, err
+}
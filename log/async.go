@@ -0,0 +1,177 @@
+package log
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 异步队列满时的处理方式
+const (
+	ASYNC_BLOCK       string = "block"       // 等待队列有空位
+	ASYNC_DROP_OLDEST string = "drop_oldest" // 丢弃队列中最早的一行
+	ASYNC_DROP_NEWEST string = "drop_newest" // 丢弃当前写入的一行
+)
+
+const DEFAULT_ASYNC_QUEUE_SIZE int = 4096
+
+// AsyncWriter 异步写，Write把日志行放入有界环形队列后立即返回，后台goroutine批量写到w
+// 队列满时按policy等待或丢弃，丢弃的行数通过Dropped获取
+type AsyncWriter struct {
+	w       io.Writer
+	policy  string
+	queue   [][]byte // 环形队列
+	head    int      // 队首下标
+	n       int      // 队列中的行数
+	writing bool     // 后台goroutine正在写出取走的一批
+	closed  bool
+	dropped int64
+	cond    *sync.Cond // 队列变化、写出完成时广播
+	done    chan struct{}
+	mu      sync.Mutex
+}
+
+/**
+* size<=0时默认4096，policy为空时默认block
+ */
+func NewAsyncWriter(w io.Writer, size int, policy string) *AsyncWriter {
+	if size <= 0 {
+		size = DEFAULT_ASYNC_QUEUE_SIZE
+	}
+	if policy == "" {
+		policy = ASYNC_BLOCK
+	}
+	aw := &AsyncWriter{
+		w:      w,
+		policy: policy,
+		queue:  make([][]byte, size),
+		done:   make(chan struct{}),
+	}
+	aw.cond = sync.NewCond(&aw.mu)
+	go aw.loop()
+
+	return aw
+}
+
+/**
+* p会被复制，调用方可以复用
+ */
+func (aw *AsyncWriter) Write(p []byte) (int, error) {
+	line := make([]byte, len(p))
+	copy(line, p)
+
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	for aw.n == len(aw.queue) && !aw.closed {
+		switch aw.policy {
+		case ASYNC_DROP_NEWEST:
+			atomic.AddInt64(&aw.dropped, 1)
+			return len(p), nil
+		case ASYNC_DROP_OLDEST:
+			aw.queue[aw.head] = nil
+			aw.head = (aw.head + 1) % len(aw.queue)
+			aw.n--
+			atomic.AddInt64(&aw.dropped, 1)
+		default:
+			aw.cond.Wait()
+		}
+	}
+	if aw.closed {
+		return 0, os.ErrClosed
+	}
+
+	aw.queue[(aw.head+aw.n)%len(aw.queue)] = line
+	aw.n++
+	aw.cond.Broadcast()
+
+	return len(p), nil
+}
+
+/**
+* 等待队列中的日志全部写出
+ */
+func (aw *AsyncWriter) Flush() {
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	for (aw.n > 0 || aw.writing) && !aw.closed {
+		aw.cond.Wait()
+	}
+}
+
+/**
+* 同Flush，最多等待timeout，超时返回false
+ */
+func (aw *AsyncWriter) FlushTimeout(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	// 到期时唤醒等待
+	timer := time.AfterFunc(timeout, func() {
+		aw.mu.Lock()
+		aw.cond.Broadcast()
+		aw.mu.Unlock()
+	})
+	defer timer.Stop()
+
+	aw.mu.Lock()
+	defer aw.mu.Unlock()
+	for (aw.n > 0 || aw.writing) && !aw.closed {
+		if !time.Now().Before(deadline) {
+			return false
+		}
+		aw.cond.Wait()
+	}
+	return true
+}
+
+/**
+* 队列满被丢弃的行数
+ */
+func (aw *AsyncWriter) Dropped() int64 {
+	return atomic.LoadInt64(&aw.dropped)
+}
+
+/**
+* 写出队列中剩余的日志后停止后台goroutine，不关闭w，可重复调用
+ */
+func (aw *AsyncWriter) Close() error {
+	aw.mu.Lock()
+	aw.closed = true
+	aw.cond.Broadcast()
+	aw.mu.Unlock()
+
+	<-aw.done
+	return nil
+}
+
+func (aw *AsyncWriter) loop() {
+	defer close(aw.done)
+	for {
+		aw.mu.Lock()
+		for aw.n == 0 && !aw.closed {
+			aw.cond.Wait()
+		}
+		if aw.n == 0 {
+			aw.mu.Unlock()
+			return
+		}
+		batch := make([][]byte, 0, aw.n)
+		for ; aw.n > 0; aw.n-- {
+			batch = append(batch, aw.queue[aw.head])
+			aw.queue[aw.head] = nil
+			aw.head = (aw.head + 1) % len(aw.queue)
+		}
+		aw.writing = true
+		aw.cond.Broadcast()
+		aw.mu.Unlock()
+
+		for _, line := range batch {
+			aw.w.Write(line)
+		}
+
+		aw.mu.Lock()
+		aw.writing = false
+		aw.cond.Broadcast()
+		aw.mu.Unlock()
+	}
+}
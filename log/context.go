@@ -0,0 +1,110 @@
+package log
+
+import (
+	"context"
+	"os"
+)
+
+// 按请求传递trace_id，替代全局SetTraceId，避免并发请求互相覆盖
+
+type traceIdKey struct{}
+
+/**
+* 返回携带traceId的ctx
+ */
+func NewContext(ctx context.Context, traceId string) context.Context {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return context.WithValue(ctx, traceIdKey{}, traceId)
+}
+
+/**
+* 从ctx中取出traceId，不存在返回空串
+ */
+func TraceIdFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	traceId, _ := ctx.Value(traceIdKey{}).(string)
+	return traceId
+}
+
+// ContextLogger 使用ctx中trace_id输出的日志，通过WithContext获取
+type ContextLogger struct {
+	logger  *Logger
+	traceId string
+}
+
+/**
+* 输出到默认logger，ctx中没有trace_id时退化为全局SetTraceId设置的值
+ */
+func WithContext(ctx context.Context) *ContextLogger {
+	return Default().WithContext(ctx)
+}
+
+func (cl *ContextLogger) Debug(args map[string]interface{}) {
+	cl.logger.print(cl.traceId, DEBUG, args)
+}
+
+func (cl *ContextLogger) Debugf(format string, args ...interface{}) {
+	cl.logger.printf(cl.traceId, DEBUG, format, args...)
+}
+
+func (cl *ContextLogger) Info(args map[string]interface{}) {
+	cl.logger.print(cl.traceId, INFO, args)
+}
+
+func (cl *ContextLogger) Infof(format string, args ...interface{}) {
+	cl.logger.printf(cl.traceId, INFO, format, args...)
+}
+
+func (cl *ContextLogger) Warning(args map[string]interface{}) {
+	cl.logger.print(cl.traceId, WARNING, args)
+}
+
+func (cl *ContextLogger) Warningf(format string, args ...interface{}) {
+	cl.logger.printf(cl.traceId, WARNING, format, args...)
+}
+
+func (cl *ContextLogger) Error(args map[string]interface{}) {
+	cl.logger.print(cl.traceId, ERROR, args)
+}
+
+func (cl *ContextLogger) Errorf(format string, args ...interface{}) {
+	cl.logger.printf(cl.traceId, ERROR, format, args...)
+}
+
+func (cl *ContextLogger) Fatal(args map[string]interface{}) {
+	cl.logger.print(cl.traceId, FATAL, args)
+	cl.logger.Sync()
+	os.Exit(1)
+}
+
+func (cl *ContextLogger) Fatalf(format string, args ...interface{}) {
+	cl.logger.printf(cl.traceId, FATAL, format, args...)
+	cl.logger.Sync()
+	os.Exit(1)
+}
+
+func (cl *ContextLogger) DebugFields(fields ...Field) {
+	cl.logger.output(3, "", cl.traceId, DEBUG, "", fields)
+}
+
+func (cl *ContextLogger) InfoFields(fields ...Field) {
+	cl.logger.output(3, "", cl.traceId, INFO, "", fields)
+}
+
+func (cl *ContextLogger) WarningFields(fields ...Field) {
+	cl.logger.output(3, "", cl.traceId, WARNING, "", fields)
+}
+
+func (cl *ContextLogger) ErrorFields(fields ...Field) {
+	cl.logger.output(3, "", cl.traceId, ERROR, "", fields)
+}
+
+func (cl *ContextLogger) FatalFields(fields ...Field) {
+	cl.logger.output(3, "", cl.traceId, FATAL, "", fields)
+	cl.logger.Sync()
+	os.Exit(1)
+}
@@ -0,0 +1,167 @@
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+// record 一条待输出的日志
+type record struct {
+	time    time.Time
+	level   Level
+	caller  string
+	traceId string
+	msg     string
+	fields  []Field
+}
+
+// buffer 编码用的缓冲区，通过bufferPool复用
+type buffer struct {
+	b []byte
+}
+
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return &buffer{b: make([]byte, 0, 1024)}
+	},
+}
+
+func getbuf() *buffer {
+	buf := bufferPool.Get().(*buffer)
+	buf.b = buf.b[:0]
+	return buf
+}
+
+/**
+* 过大的缓冲区不放回，避免偶尔的大日志长期占用内存
+ */
+func putbuf(buf *buffer) {
+	if cap(buf.b) > 64*1024 {
+		return
+	}
+	bufferPool.Put(buf)
+}
+
+// fieldBuffer 输出时合并字段用的切片，通过fieldPool复用，调用方的字段切片不会逃逸到堆上
+type fieldBuffer struct {
+	f []Field
+}
+
+var fieldPool = sync.Pool{
+	New: func() interface{} {
+		return &fieldBuffer{f: make([]Field, 0, 16)}
+	},
+}
+
+func getfields() *fieldBuffer {
+	return fieldPool.Get().(*fieldBuffer)
+}
+
+/**
+* 清除字段的引用后放回，不持有已输出日志的值
+ */
+func putfields(fb *fieldBuffer) {
+	if cap(fb.f) > 256 {
+		return
+	}
+	f := fb.f[:cap(fb.f)]
+	for i := range f {
+		f[i] = Field{}
+	}
+	fb.f = f[:0]
+	fieldPool.Put(fb)
+}
+
+func encode(format string, r *record) *buffer {
+	buf := getbuf()
+	if format == FORMAT_JSON {
+		buf.b = appendJsonRecord(buf.b, r)
+	} else {
+		buf.b = appendTextRecord(buf.b, r)
+	}
+	return buf
+}
+
+/**
+* 【LEVEL】2006/01/02 15:04:05.000000 [caller] k=v||k=v||trace_id=xx||msg
+ */
+func appendTextRecord(b []byte, r *record) []byte {
+	b = append(b, "【"...)
+	b = append(b, levelToString(r.level)...)
+	b = append(b, "】"...)
+	b = r.time.AppendFormat(b, FORMAT_TIME_TEXT)
+	b = append(b, " ["...)
+	b = append(b, r.caller...)
+	b = append(b, "] "...)
+
+	sep := false
+	for i := range r.fields {
+		if sep {
+			b = append(b, "||"...)
+		}
+		b = append(b, r.fields[i].Key...)
+		b = append(b, '=')
+		b = r.fields[i].appendText(b)
+		sep = true
+	}
+	if r.traceId != "" {
+		if sep {
+			b = append(b, "||"...)
+		}
+		b = append(b, "trace_id="...)
+		b = append(b, r.traceId...)
+		sep = true
+	}
+	if r.msg != "" {
+		if sep {
+			b = append(b, "||"...)
+		}
+		b = append(b, r.msg...)
+	}
+
+	if len(b) == 0 || b[len(b)-1] != '\n' {
+		b = append(b, '\n')
+	}
+	return b
+}
+
+/**
+* 一行一个json对象，固定字段time/level/caller/trace_id/msg在前，其余字段按顺序在后
+* 与固定字段同名的字段输出为 fields.level 等
+ */
+func appendJsonRecord(b []byte, r *record) []byte {
+	b = append(b, `{"time":"`...)
+	b = r.time.AppendFormat(b, FORMAT_TIME_JSON)
+	b = append(b, `","level":"`...)
+	b = append(b, levelToString(r.level)...)
+	b = append(b, `","caller":`...)
+	b = appendJsonString(b, r.caller)
+	if r.traceId != "" {
+		b = append(b, `,"trace_id":`...)
+		b = appendJsonString(b, r.traceId)
+	}
+	if r.msg != "" {
+		b = append(b, `,"msg":`...)
+		b = appendJsonString(b, r.msg)
+	}
+	for i := range r.fields {
+		b = append(b, ',')
+		if isReservedKey(r.fields[i].Key) {
+			// 与固定字段同名时加前缀，避免重复的key覆盖真实的level/time等
+			b = appendJsonString(b, "fields."+r.fields[i].Key)
+		} else {
+			b = appendJsonString(b, r.fields[i].Key)
+		}
+		b = append(b, ':')
+		b = r.fields[i].appendJson(b)
+	}
+	return append(b, '}', '\n')
+}
+
+func isReservedKey(key string) bool {
+	switch key {
+	case "time", "level", "caller", "trace_id", "msg":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,312 @@
+package log
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+type fieldType uint8
+
+const (
+	stringType fieldType = iota
+	intType
+	floatType
+	boolType
+	durationType
+	errorType
+	anyType
+)
+
+// Field 带类型的字段，输出时直接写入缓冲区，不经过map以及fmt
+type Field struct {
+	Key string
+	typ fieldType
+	num int64 // int/bool/duration，float存math.Float64bits
+	str string
+	val interface{} // error/any
+}
+
+func String(key string, value string) Field {
+	return Field{Key: key, typ: stringType, str: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, typ: intType, num: int64(value)}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, typ: intType, num: value}
+}
+
+func Float64(key string, value float64) Field {
+	return Field{Key: key, typ: floatType, num: int64(math.Float64bits(value))}
+}
+
+func Bool(key string, value bool) Field {
+	f := Field{Key: key, typ: boolType}
+	if value {
+		f.num = 1
+	}
+	return f
+}
+
+/**
+* 输出为毫秒，同helper.FormatDurationToMs，如 1.23ms
+ */
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, typ: durationType, num: int64(value)}
+}
+
+/**
+* key为errmsg，与map方式的日志字段一致，err为nil时输出空串
+ */
+func Err(err error) Field {
+	return Field{Key: "errmsg", typ: errorType, val: err}
+}
+
+/**
+* 常见类型转为对应的typed字段，其余类型json方式输出同jsonValue，text方式输出同%v
+ */
+func Any(key string, value interface{}) Field {
+	switch v := value.(type) {
+	case string:
+		return String(key, v)
+	case int:
+		return Int(key, v)
+	case int64:
+		return Int64(key, v)
+	case int32:
+		return Int64(key, int64(v))
+	case float64:
+		return Float64(key, v)
+	case float32:
+		return Float64(key, float64(v))
+	case bool:
+		return Bool(key, v)
+	case time.Duration:
+		return Duration(key, v)
+	case error:
+		return Field{Key: key, typ: errorType, val: v}
+	}
+	return Field{Key: key, typ: anyType, val: value}
+}
+
+/**
+* 字段的值，Hook的Entry.Fields使用，duration为 1.23ms 形式的字符串
+ */
+func (f Field) Value() interface{} {
+	switch f.typ {
+	case stringType:
+		return f.str
+	case intType:
+		return f.num
+	case floatType:
+		return math.Float64frombits(uint64(f.num))
+	case boolType:
+		return f.num == 1
+	case durationType:
+		return string(f.appendText(nil))
+	}
+	return f.val
+}
+
+/**
+* 按key排序转为字段，map方式的日志输出顺序固定
+ */
+func mapFields(m map[string]interface{}) []Field {
+	if len(m) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	fields := make([]Field, 0, len(keys))
+	for _, k := range keys {
+		fields = append(fields, Any(k, m[k]))
+	}
+	return fields
+}
+
+func fieldsMap(fields []Field) map[string]interface{} {
+	m := make(map[string]interface{}, len(fields))
+	for _, f := range fields {
+		m[f.Key] = f.Value()
+	}
+	return m
+}
+
+/**
+* base与fields合并后追加到dst，与fields同名的base字段被覆盖
+ */
+func appendFields(dst []Field, base []Field, fields []Field) []Field {
+	for _, f := range base {
+		if indexField(fields, f.Key) < 0 {
+			dst = append(dst, f)
+		}
+	}
+	return append(dst, fields...)
+}
+
+func indexField(fields []Field, key string) int {
+	for i := range fields {
+		if fields[i].Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+/**
+* text方式的值
+ */
+func (f Field) appendText(b []byte) []byte {
+	switch f.typ {
+	case stringType:
+		return append(b, f.str...)
+	case intType:
+		return strconv.AppendInt(b, f.num, 10)
+	case floatType:
+		return strconv.AppendFloat(b, math.Float64frombits(uint64(f.num)), 'g', -1, 64)
+	case boolType:
+		return strconv.AppendBool(b, f.num == 1)
+	case durationType:
+		b = strconv.AppendFloat(b, float64(f.num)/float64(time.Millisecond), 'f', 2, 64)
+		return append(b, "ms"...)
+	case errorType:
+		if f.val == nil {
+			return b
+		}
+		return append(b, errorText(f.val.(error))...)
+	}
+	return append(b, fmt.Sprintf("%v", f.val)...)
+}
+
+/**
+* json方式的值
+ */
+func (f Field) appendJson(b []byte) []byte {
+	switch f.typ {
+	case stringType:
+		return appendJsonString(b, f.str)
+	case intType:
+		return strconv.AppendInt(b, f.num, 10)
+	case floatType:
+		v := math.Float64frombits(uint64(f.num))
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return appendJsonString(b, strconv.FormatFloat(v, 'g', -1, 64))
+		}
+		return strconv.AppendFloat(b, v, 'g', -1, 64)
+	case boolType:
+		return strconv.AppendBool(b, f.num == 1)
+	case durationType:
+		b = append(b, '"')
+		b = f.appendText(b)
+		return append(b, '"')
+	case errorType:
+		if f.val == nil {
+			return append(b, `""`...)
+		}
+		return appendJsonString(b, errorText(f.val.(error)))
+	}
+	return append(b, jsonValue(f.val)...)
+}
+
+/**
+* err.Error()，nil指针的error等导致panic时同%v输出，如 <nil>，日志调用不能panic
+ */
+func errorText(err error) (s string) {
+	defer func() {
+		if recover() != nil {
+			s = fmt.Sprintf("%v", err)
+		}
+	}()
+	return err.Error()
+}
+
+/**
+* 同errorText
+ */
+func stringerText(v fmt.Stringer) (s string) {
+	defer func() {
+		if recover() != nil {
+			s = fmt.Sprintf("%v", v)
+		}
+	}()
+	return v.String()
+}
+
+/**
+* nil以及nil指针等包在interface中的nil值
+ */
+func isNilValue(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
+
+const hexDigits = "0123456789abcdef"
+
+/**
+* 与encoding/json相同的转义，但不转义<>&
+ */
+func appendJsonString(b []byte, s string) []byte {
+	b = append(b, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if r == utf8.RuneError && size == 1 {
+				b = append(b, s[start:i]...)
+				b = append(b, `\ufffd`...)
+				i += size
+				start = i
+				continue
+			}
+			if r == '\u2028' || r == '\u2029' {
+				b = append(b, s[start:i]...)
+				b = append(b, `\u202`...)
+				b = append(b, hexDigits[r&0xF])
+				i += size
+				start = i
+				continue
+			}
+			i += size
+			continue
+		}
+		if c >= 0x20 && c != '"' && c != '\\' {
+			i++
+			continue
+		}
+		b = append(b, s[start:i]...)
+		switch c {
+		case '"', '\\':
+			b = append(b, '\\', c)
+		case '\n':
+			b = append(b, '\\', 'n')
+		case '\r':
+			b = append(b, '\\', 'r')
+		case '\t':
+			b = append(b, '\\', 't')
+		default:
+			b = append(b, `\u00`...)
+			b = append(b, hexDigits[c>>4], hexDigits[c&0xF])
+		}
+		i++
+		start = i
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
@@ -0,0 +1,54 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	FORMAT_TEXT string = "text"
+	FORMAT_JSON string = "json"
+)
+
+const FORMAT_TIME_JSON string = "2006-01-02T15:04:05.000000Z07:00"
+
+/**
+* 一行json，不含换行，map字段按key排序
+ */
+func jsonLine(t time.Time, level Level, caller string, traceId string, m map[string]interface{}, msg string) string {
+	r := &record{time: t, level: level, caller: caller, traceId: traceId, msg: msg, fields: mapFields(m)}
+	buf := getbuf()
+	defer putbuf(buf)
+	buf.b = appendJsonRecord(buf.b, r)
+	return string(buf.b[:len(buf.b)-1])
+}
+
+/**
+* error/Stringer按字符串输出，无法序列化的值退化为%v
+* 不转义<>&，调用栈中的 <- 保持可读
+ */
+func jsonValue(value interface{}) []byte {
+	switch v := value.(type) {
+	case error:
+		value = errorText(v)
+	case fmt.Stringer:
+		value = stringerText(v)
+	}
+	b, err := marshalNoEscape(value)
+	if err != nil {
+		b, _ = marshalNoEscape(fmt.Sprintf("%v", value))
+	}
+	return b
+}
+
+func marshalNoEscape(value interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
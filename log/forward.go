@@ -0,0 +1,63 @@
+package log
+
+import (
+	"time"
+)
+
+// ForwardHook 按行发送json到远程收集服务(logstash tcp input、fluentd等)
+// 日志先进入本地有界队列，后台goroutine发送，断线时按ReconnectMs重连，期间日志留在队列中
+// 队列满时丢弃最旧的，丢弃行数通过Dropped获取
+type ForwardHook struct {
+	Addr           string
+	Level          Level // 只发送该级别及以上，默认ALL
+	ConnTimeoutMs  int   // 默认1000
+	WriteTimeoutMs int   // 默认1000
+	ReconnectMs    int   // 首次重连间隔，之后翻倍，默认1000
+
+	sender *sender
+}
+
+/**
+* bufferSize为本地队列行数，<=0时默认4096
+ */
+func NewForwardHook(addr string, bufferSize int) *ForwardHook {
+	h := &ForwardHook{
+		Addr:           addr,
+		Level:          ALL,
+		ConnTimeoutMs:  1000,
+		WriteTimeoutMs: 1000,
+		ReconnectMs:    1000,
+	}
+	h.sender = newSender(h, bufferSize)
+	return h
+}
+
+func (h *ForwardHook) Fire(entry *Entry) error {
+	if entry.Level > h.Level {
+		return nil
+	}
+	return h.sender.write([]byte(entry.Json() + "\n"))
+}
+
+/**
+* 等待队列发送完，最多等待timeout，超时返回ErrFlushTimeout，logger Sync时调用
+ */
+func (h *ForwardHook) Flush(timeout time.Duration) error {
+	return h.sender.flush(timeout)
+}
+
+func (h *ForwardHook) Dropped() int64 {
+	return h.sender.queue.Dropped()
+}
+
+/**
+* 发送队列中剩余的日志，连接不上时放弃，可重复调用
+ */
+func (h *ForwardHook) Close() error {
+	return h.sender.close()
+}
+
+func (h *ForwardHook) dialConfig() (string, string, time.Duration, time.Duration, time.Duration) {
+	return "tcp", h.Addr, time.Duration(h.ConnTimeoutMs) * time.Millisecond,
+		time.Duration(h.WriteTimeoutMs) * time.Millisecond, time.Duration(h.ReconnectMs) * time.Millisecond
+}
@@ -0,0 +1,92 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const HOOK_FLUSH_TIMEOUT_MS int = 1000 // Sync时等待所有Hook队列发送完的最长时间
+
+var ErrFlushTimeout = errors.New("log: flush hook timeout")
+
+// Entry 一条日志，传给Hook
+type Entry struct {
+	Time    time.Time
+	Level   Level
+	Caller  string
+	TraceId string
+	Msg     string                 // 格式化输出的内容，非格式化输出为空
+	Fields  map[string]interface{} // 合并固定字段并打码后的字段，Hook不能修改
+}
+
+/**
+* 一行json，与Format为json时的输出相同
+ */
+func (e *Entry) Json() string {
+	return jsonLine(e.Time, e.Level, e.Caller, e.TraceId, e.Fields, e.Msg)
+}
+
+// Hook 每条通过级别、采样以及限流的日志都会调用Fire，用于发送到syslog、远程收集等
+// Fire在打日志的goroutine中同步执行，耗时的Hook需要自己异步处理
+// 实现了io.Closer的Hook在logger Close时关闭
+type Hook interface {
+	Fire(entry *Entry) error
+}
+
+// Flusher 有本地队列的Hook实现，logger Sync(包括Fatal退出前)时等待队列发送完，最多等待timeout
+type Flusher interface {
+	Flush(timeout time.Duration) error
+}
+
+func AddHook(hook Hook) {
+	Default().AddHook(hook)
+}
+
+/**
+* 添加Hook，与父/子logger共享，Reload不影响
+ */
+func (lg *Logger) AddHook(hook Hook) {
+	lg.out.mu.Lock()
+	defer lg.out.mu.Unlock()
+	// 复制后替换，输出时无需持锁遍历
+	hooks := make([]Hook, 0, len(lg.out.hooks)+1)
+	hooks = append(hooks, lg.out.hooks...)
+	lg.out.hooks = append(hooks, hook)
+}
+
+/**
+* Hook出错输出到标准错误，不影响本地日志
+ */
+func fireHooks(hooks []Hook, entry *Entry) {
+	for _, hook := range hooks {
+		if err := hook.Fire(entry); err != nil {
+			fmt.Fprintf(os.Stderr, "log: fire hook %T failed, err=%s\n", hook, err.Error())
+		}
+	}
+}
+
+/**
+* 所有Hook共用timeout，返回最后一个错误
+ */
+func flushHooks(hooks []Hook, timeout time.Duration) (err error) {
+	deadline := time.Now().Add(timeout)
+	for _, hook := range hooks {
+		if flusher, ok := hook.(Flusher); ok {
+			if e := flusher.Flush(time.Until(deadline)); e != nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+func closeHooks(hooks []Hook) {
+	for _, hook := range hooks {
+		if closer, ok := hook.(io.Closer); ok {
+			closer.Close()
+		}
+	}
+}
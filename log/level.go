@@ -0,0 +1,101 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+func (level Level) String() string {
+	return levelToString(level)
+}
+
+/**
+* 解析级别名称，不区分大小写，无法识别时返回错误
+ */
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToUpper(s) {
+	case "FATAL":
+		return FATAL, nil
+	case "ERROR":
+		return ERROR, nil
+	case "WARNING":
+		return WARNING, nil
+	case "INFO":
+		return INFO, nil
+	case "DEBUG":
+		return DEBUG, nil
+	case "ALL":
+		return ALL, nil
+	}
+	return ALL, fmt.Errorf("unknown log level %q", s)
+}
+
+func SetLevel(level Level) {
+	Default().SetLevel(level)
+}
+
+func GetLevel() Level {
+	return Default().GetLevel()
+}
+
+/**
+* 运行时修改级别，与父/子logger共享，配置了Sinks时各sink的Level仍然生效
+ */
+func (lg *Logger) SetLevel(level Level) {
+	lg.out.mu.Lock()
+	defer lg.out.mu.Unlock()
+	lg.out.config.Level = levelToString(level)
+	atomic.StoreInt32(&lg.out.level, int32(level))
+}
+
+func (lg *Logger) GetLevel() Level {
+	return Level(atomic.LoadInt32(&lg.out.level))
+}
+
+// LevelHandler 查看/修改级别的http接口，Logger为nil时作用于默认logger
+// GET 返回 {"level":"INFO"}
+// PUT/POST 参数level=DEBUG或body {"level":"DEBUG"}，返回修改后的级别
+type LevelHandler struct {
+	Logger *Logger
+}
+
+func (h *LevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	lg := h.Logger
+	if lg == nil {
+		lg = Default()
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut, http.MethodPost:
+		name := r.FormValue("level")
+		if name == "" {
+			var body struct {
+				Level string `json:"level"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			name = body.Level
+		}
+		level, err := ParseLevel(name)
+		if err != nil {
+			writeLevelResponse(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		lg.SetLevel(level)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		writeLevelResponse(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	writeLevelResponse(w, http.StatusOK, map[string]string{"level": lg.GetLevel().String()})
+}
+
+func writeLevelResponse(w http.ResponseWriter, status int, body map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
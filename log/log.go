@@ -8,9 +8,8 @@ import (
 	"io/ioutil"
 	syslog "log"
 	"os"
-	"path"
-	"regexp"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -32,192 +31,582 @@ const (
 // 实现trace_id跟踪
 // 实现日志切割/删除
 
+// Log 日志输出状态，Logger与其With派生的子logger共享
 type Log struct {
-	logger     *syslog.Logger
+	main       *sink   // 未配置Sinks时的输出
+	sinks      []*sink // 配置了Sinks时输出到各个sink，不再输出到main
 	config     LogConfig
+	level      int32 // 当前级别，原子读写，每次输出不再解析config.Level
+	stackLevel int32 // 该级别及以上附带调用栈，-1不附带
+	callerSkip int32
 	traceId    string // 请求id，用于调用链跟踪
-	rotateTime string // .log -> .log.(rotateTime)
-	mu         sync.Mutex
+	sampler    *sampler
+	limiter    *limiter
+	redactor   *redactor
+	hooks      []Hook
+	limited    int64 // 被限流丢弃的行数
+	stopWatch  chan struct{}
+	mu         sync.RWMutex
+	writing    sync.RWMutex // 写sink期间持有读锁，替换后等待进行中的写完成再关闭旧的sink
 }
 
-type LogConfig struct {
-	Type          string // std/file
-	Level         string // DEBUG/INFO/WARNING/ERROR/FATAL
-	Dir           string // 文件目录
-	FileName      string // 文件名
-	RotateByHour  bool   // 按小时切割
-	RotateByDaily bool   // 按天切割
-	KeepDays      int    // 保留天数
+/**
+* 一个输出目的地，只输出级别不低于level的日志
+ */
+type sink struct {
+	logger *syslog.Logger
+	direct io.Writer     // 按配置创建的输出，无前缀，编码好的行直接写入，不经过logger
+	writer *RotateWriter // Type为file时持有的文件
+	async  *AsyncWriter  // Async时logger经由async写writer
+	level  Level
+	format string
 }
 
-var l Log
-
-func init() {
-	// 设置默认输出logger
-	conf := LogConfig{
-		Type: "std",
+/**
+* 输出一行
+ */
+func (s *sink) write(b []byte) {
+	if s.direct != nil {
+		s.direct.Write(b)
+		return
 	}
-	SetLogger(newLogger(conf))
+	s.logger.Print(string(b))
+}
+
+type LogConfig struct {
+	Type           string // std/file
+	Level          string // DEBUG/INFO/WARNING/ERROR/FATAL
+	Dir            string // 文件目录
+	FileName       string // 文件名
+	RotateByHour   bool   // 按小时切割
+	RotateByDaily  bool   // 按天切割
+	MaxSizeMB      int    // 按大小切割，单位MB，0表示不按大小切割，可与按时间切割同时使用
+	KeepDays       int    // 保留天数
+	MaxBackups     int    // 最多保留的切割文件个数，0不限制
+	MaxTotalSizeMB int    // 切割文件总大小上限，单位MB，超出时删除最旧的，0不限制
+	Compress       bool   // 后台gzip压缩切割文件
+	Format         string // text/json，默认text
+	Async          bool   // 异步写，日志进入有界队列后由后台goroutine写出
+	AsyncQueueSize int    // 异步队列长度，默认4096
+	AsyncPolicy    string // 队列满时 block/drop_oldest/drop_newest，默认block
+	SampleKey      string // 按该字段的值采样，如action，ERROR及以上、errmsg不为空以及慢调用不采样
+	SampleRate     int    // 同一值每秒第一条之后每N条记录1条，<=1不采样
+	SampleSlowMs   int    // cost字段不低于该值时不采样，单位ms，0表示不判断
+	RateLimit      int    // 每秒最多输出的行数，超出丢弃，FATAL不受限制，0不限制
+	RateBurst      int    // 允许的突发行数，默认RateLimit
+
+	RedactKeys   []string // 字段名匹配这些正则(不区分大小写)时整个值打码，sql中同名列的值同样打码，如 password|token
+	RedactValues []string // 字符串值以及格式化输出中匹配这些正则的部分打码，如手机号 1[3-9]\d{9}
+	RedactStyle  string   // 打码方式 full(默认)/partial/hash
+
+	CallerSkip int    // 封装了日志函数时额外跳过的调用层数，使caller指向业务代码
+	StackLevel string // 该级别及以上附带调用栈stack字段，如ERROR，为空不附带
+
+	// 多个输出目的地，每个sink有自己的Type/Level/Format以及切割配置，Dir/Format/Async配置为空时沿用外层配置
+	// 配置Sinks后外层Level作为总的级别，外层Type/FileName以及切割配置不再生效
+	// 如 app.log记录全部日志，app.log.wf只记录WARNING及以上，同时输出到标准输出
+	Sinks []LogConfig
 }
 
+/**
+* 读取配置文件重新设置默认logger，可重复调用，之前打开的日志文件会被关闭
+ */
 func Init(path string) error {
-	var conf LogConfig
-	if res, err := ioutil.ReadFile(path); err != nil {
-		return errors.New("error opening conf file=" + path)
+	return Default().Reload(path)
+}
+
+func loadConfig(path string) (conf LogConfig, err error) {
+	if res, e := ioutil.ReadFile(path); e != nil {
+		err = errors.New("error opening conf file=" + path)
 	} else {
-		if err := json.Unmarshal(res, &conf); err != nil {
-			msg := fmt.Sprintf("error parsing conf file=%s, err=%s", path, err.Error())
-			return errors.New(msg)
+		if e := json.Unmarshal(res, &conf); e != nil {
+			msg := fmt.Sprintf("error parsing conf file=%s, err=%s", path, e.Error())
+			err = errors.New(msg)
 		}
 	}
+	return
+}
 
-	SetConfig(conf)
-	SetLogger(newLogger(conf))
-	SetRotateTime(getCurrentTime(conf))
+/**
+* 关闭默认logger的日志文件并停止后台清理，之后输出到标准输出
+ */
+func Close() error {
+	return Default().Close()
+}
 
-	// 日志切割
-	go rotateDaemon()
+/**
+* 写出默认logger异步队列中的日志并刷盘
+ */
+func Sync() error {
+	return Default().Sync()
+}
 
-	return nil
+/**
+* 默认logger异步队列满时丢弃的日志行数
+ */
+func Dropped() int64 {
+	return Default().Dropped()
+}
+
+/**
+* 默认logger超过RateLimit被丢弃的日志行数
+ */
+func Limited() int64 {
+	return Default().Limited()
 }
 
+// 全局trace_id，并发请求会互相覆盖，按请求记录请使用NewContext/WithContext
 func SetTraceId(traceId string) {
-	l.traceId = traceId
+	Default().SetTraceId(traceId)
 }
 
 func SetConfig(conf LogConfig) {
-	l.config = conf
+	Default().SetConfig(conf)
 }
 
+/**
+* 自定义输出，logger的前缀与flag会加在每行之前
+ */
 func SetLogger(logger *syslog.Logger) {
-	l.logger = logger
+	Default().SetLogger(logger)
 }
 
+/**
+* 切割时间由RotateWriter根据文件修改时间维护，保留该函数兼容旧调用
+ */
 func SetRotateTime(rotateTime string) {
-	l.rotateTime = rotateTime
 }
 
-// 以下日志输出函数
+// 以下日志输出函数，均输出到默认logger
 // 规定所有非格式化输出参数为map，方便合并trace_id以及
 
 func Debug(args map[string]interface{}) {
-	print(DEBUG, args)
+	lg := Default()
+	lg.print(lg.out.getTraceId(), DEBUG, args)
 }
 
 func Debugf(format string, args ...interface{}) {
-	printf(DEBUG, format, args...)
+	lg := Default()
+	lg.printf(lg.out.getTraceId(), DEBUG, format, args...)
 }
 
 func Info(args map[string]interface{}) {
-	print(INFO, args)
+	lg := Default()
+	lg.print(lg.out.getTraceId(), INFO, args)
 }
 
 func Infof(format string, args ...interface{}) {
-	printf(INFO, format, args...)
+	lg := Default()
+	lg.printf(lg.out.getTraceId(), INFO, format, args...)
 }
 
 func Warning(args map[string]interface{}) {
-	print(WARNING, args)
+	lg := Default()
+	lg.print(lg.out.getTraceId(), WARNING, args)
 }
 
 func Warningf(format string, args ...interface{}) {
-	printf(WARNING, format, args...)
+	lg := Default()
+	lg.printf(lg.out.getTraceId(), WARNING, format, args...)
 }
 
 func Error(args map[string]interface{}) {
-	print(ERROR, args)
+	lg := Default()
+	lg.print(lg.out.getTraceId(), ERROR, args)
 }
 
 func Errorf(format string, args ...interface{}) {
-	printf(ERROR, format, args...)
+	lg := Default()
+	lg.printf(lg.out.getTraceId(), ERROR, format, args...)
 }
 
 func Fatal(args map[string]interface{}) {
-	print(FATAL, args)
+	lg := Default()
+	lg.print(lg.out.getTraceId(), FATAL, args)
+	lg.Sync()
 	os.Exit(1)
 }
 
 func Fatalf(format string, args ...interface{}) {
-	printf(FATAL, format, args...)
+	lg := Default()
+	lg.printf(lg.out.getTraceId(), FATAL, format, args...)
+	lg.Sync()
 	os.Exit(1)
 }
 
-/*
-* 非格式化输出，合并trace_id
+func DebugFields(fields ...Field) {
+	lg := Default()
+	lg.output(3, "", lg.out.getTraceId(), DEBUG, "", fields)
+}
+
+func InfoFields(fields ...Field) {
+	lg := Default()
+	lg.output(3, "", lg.out.getTraceId(), INFO, "", fields)
+}
+
+func WarningFields(fields ...Field) {
+	lg := Default()
+	lg.output(3, "", lg.out.getTraceId(), WARNING, "", fields)
+}
+
+func ErrorFields(fields ...Field) {
+	lg := Default()
+	lg.output(3, "", lg.out.getTraceId(), ERROR, "", fields)
+}
+
+func FatalFields(fields ...Field) {
+	lg := Default()
+	lg.output(3, "", lg.out.getTraceId(), FATAL, "", fields)
+	lg.Sync()
+	os.Exit(1)
+}
+
+/**
+* 按配置打开输出，Type为file时由RotateWriter在写入时完成切割
+ */
+func (out *Log) setup(conf LogConfig) error {
+	redactor, err := newRedactor(conf)
+	if err != nil {
+		return err
+	}
+
+	var sinks []*sink
+	for _, sc := range conf.Sinks {
+		if sc.Dir == "" {
+			sc.Dir = conf.Dir
+		}
+		if sc.Format == "" {
+			sc.Format = conf.Format
+		}
+		if !sc.Async && conf.Async {
+			sc.Async, sc.AsyncQueueSize, sc.AsyncPolicy = true, conf.AsyncQueueSize, conf.AsyncPolicy
+		}
+		s, err := newSink(sc)
+		if err != nil {
+			closeSinks(sinks)
+			return err
+		}
+		sinks = append(sinks, s)
+	}
+
+	main := stdSink()
+	if len(sinks) == 0 {
+		s, err := newSink(conf)
+		if err != nil {
+			return err
+		}
+		main = s
+	}
+
+	out.mu.Lock()
+	old := append([]*sink{out.main}, out.sinks...)
+	out.storeConfig(conf)
+	out.main = main
+	out.sinks = sinks
+	out.sampler = newSampler(conf)
+	out.limiter = newLimiter(conf)
+	out.redactor = redactor
+	out.mu.Unlock()
+
+	out.retire(old)
+	return nil
+}
+
+/**
+* 替换输出，之前的文件以及配置的sink被关闭
  */
-func print(level Level, m map[string]interface{}) {
-	if level > stringToLevel(l.config.Level) {
+func (out *Log) setLogger(logger *syslog.Logger) {
+	out.mu.Lock()
+	old := append([]*sink{out.main}, out.sinks...)
+	out.main = &sink{logger: logger}
+	out.sinks = nil
+	out.mu.Unlock()
+
+	out.retire(old)
+}
+
+func (out *Log) close() error {
+	out.mu.Lock()
+	if out.stopWatch != nil {
+		close(out.stopWatch)
+		out.stopWatch = nil
+	}
+	old := append([]*sink{out.main}, out.sinks...)
+	hooks := out.hooks
+	out.main = stdSink()
+	out.sinks = nil
+	out.hooks = nil
+	out.mu.Unlock()
+
+	closeHooks(hooks)
+	return out.retire(old)
+}
+
+/**
+* 等待已取得旧sink的写完成后关闭，之后的写使用新的sink
+ */
+func (out *Log) retire(old []*sink) error {
+	out.writing.Lock()
+	out.writing.Unlock()
+	return closeSinks(old)
+}
+
+/**
+* 等待异步队列写出并刷盘，Hook队列最多等待HOOK_FLUSH_TIMEOUT_MS，返回最后一个错误
+ */
+func (out *Log) sync() (err error) {
+	out.mu.RLock()
+	sinks := append([]*sink{out.main}, out.sinks...)
+	hooks := out.hooks
+	out.mu.RUnlock()
+
+	if e := flushHooks(hooks, time.Duration(HOOK_FLUSH_TIMEOUT_MS)*time.Millisecond); e != nil {
+		err = e
+	}
+	for _, s := range sinks {
+		if s.async != nil {
+			s.async.Flush()
+		}
+		if s.writer != nil {
+			if e := s.writer.Sync(); e != nil {
+				err = e
+			}
+		}
+	}
+	return err
+}
+
+func (out *Log) dropped() (n int64) {
+	out.mu.RLock()
+	defer out.mu.RUnlock()
+	for _, s := range append([]*sink{out.main}, out.sinks...) {
+		if s.async != nil {
+			n += s.async.Dropped()
+		}
+	}
+	return n
+}
+
+/**
+* 保存配置，调用方持有锁
+ */
+func (out *Log) storeConfig(conf LogConfig) {
+	out.config = conf
+	atomic.StoreInt32(&out.level, int32(stringToLevel(conf.Level)))
+	atomic.StoreInt32(&out.callerSkip, int32(conf.CallerSkip))
+	stackLevel := int32(-1)
+	if conf.StackLevel != "" {
+		stackLevel = int32(stringToLevel(conf.StackLevel))
+	}
+	atomic.StoreInt32(&out.stackLevel, stackLevel)
+}
+
+func (out *Log) withStack(level Level) bool {
+	return int32(level) <= atomic.LoadInt32(&out.stackLevel)
+}
+
+func (out *Log) enabled(level Level) bool {
+	return level <= Level(atomic.LoadInt32(&out.level))
+}
+
+// state 输出一条日志需要的状态，一次加锁取出，sink在write时另外取出
+type state struct {
+	sampler  *sampler
+	limiter  *limiter
+	redactor *redactor
+	hooks    []Hook
+}
+
+func (out *Log) state() state {
+	out.mu.RLock()
+	defer out.mu.RUnlock()
+	return state{
+		sampler:  out.sampler,
+		limiter:  out.limiter,
+		redactor: out.redactor,
+		hooks:    out.hooks,
+	}
+}
+
+/**
+* 采样以及限流
+ */
+func (out *Log) allow(st *state, level Level, fields []Field) bool {
+	if st.sampler != nil && !st.sampler.sample(level, fields) {
+		return false
+	}
+	if st.limiter != nil && level > FATAL && !st.limiter.allow() {
+		atomic.AddInt64(&out.limited, 1)
+		return false
+	}
+	return true
+}
+
+/**
+* 输出到各个sink，同一格式只编码一次
+ */
+func (out *Log) write(r *record) {
+	out.writing.RLock()
+	defer out.writing.RUnlock()
+	out.mu.RLock()
+	main, sinks, format := out.main, out.sinks, out.config.Format
+	out.mu.RUnlock()
+
+	if len(sinks) == 0 {
+		buf := encode(format, r)
+		main.write(buf.b)
+		putbuf(buf)
 		return
 	}
-	if l.traceId != "" {
-		m["trace_id"] = l.traceId
+
+	var text, json *buffer
+	for _, s := range sinks {
+		if r.level > s.level {
+			continue
+		}
+		if s.format == FORMAT_JSON {
+			if json == nil {
+				json = encode(FORMAT_JSON, r)
+			}
+			s.write(json.b)
+		} else {
+			if text == nil {
+				text = encode(FORMAT_TEXT, r)
+			}
+			s.write(text.b)
+		}
+	}
+	if text != nil {
+		putbuf(text)
 	}
-	l.logger.SetPrefix(getPrefixByLevel(level))
+	if json != nil {
+		putbuf(json)
+	}
+}
 
-	header := header()
-	body := mapToStr(m)
+func (out *Log) getTraceId() string {
+	out.mu.RLock()
+	defer out.mu.RUnlock()
+	return out.traceId
+}
 
-	buf := contentToBuffer(header, body)
-	l.logger.Println(buf)
+/*
+* 非格式化输出，map按key排序转为字段
+ */
+func (lg *Logger) print(traceId string, level Level, m map[string]interface{}) {
+	if !lg.out.enabled(level) {
+		return
+	}
+	lg.output(4, "", traceId, level, "", mapFields(m))
 }
 
-func printf(level Level, format string, args ...interface{}) {
-	if level > stringToLevel(l.config.Level) {
+func (lg *Logger) printf(traceId string, level Level, format string, args ...interface{}) {
+	if !lg.out.enabled(level) {
 		return
 	}
-	l.logger.SetPrefix(getPrefixByLevel(level))
+	lg.output(4, "", traceId, level, fmt.Sprintf(format, args...), nil)
+}
+
+/**
+* 合并固定字段，采样、限流、打码后输出
+* skip为getCaller的参数，caller不为空时直接使用
+ */
+func (lg *Logger) output(skip int, caller string, traceId string, level Level, msg string, fields []Field) {
+	if !lg.out.enabled(level) {
+		return
+	}
+	st := lg.out.state()
+	// 合并到复用的切片，fields只在这里读取，调用方的可变参数切片可以分配在栈上
+	fb := getfields()
+	defer putfields(fb)
+	fb.f = appendFields(fb.f, lg.fields, fields)
+	merged := fb.f
+	if !lg.out.allow(&st, level, merged) {
+		return
+	}
+	if st.redactor != nil {
+		msg = st.redactor.redactString(msg)
+		merged = st.redactor.redactFields(merged)
+	}
+	skip += lg.callerSkip()
+	if caller == "" {
+		caller = getCaller(skip)
+	}
+	if lg.out.withStack(level) && indexField(merged, "stack") < 0 {
+		merged = append(merged, String("stack", getStack(skip)))
+	}
+
+	r := record{
+		time:    time.Now(),
+		level:   level,
+		caller:  caller,
+		traceId: traceId,
+		msg:     msg,
+		fields:  merged,
+	}
+	if len(st.hooks) > 0 {
+		fireHooks(st.hooks, &Entry{Time: r.time, Level: level, Caller: caller, TraceId: traceId, Msg: msg, Fields: fieldsMap(merged)})
+	}
+	lg.out.write(&r)
+}
 
-	header := header()
-	body := fmt.Sprintf(format, args...)
+func (lg *Logger) callerSkip() int {
+	return lg.skip + int(atomic.LoadInt32(&lg.out.callerSkip))
+}
 
-	buf := contentToBuffer(header, body)
-	l.logger.Printf(buf.String())
+func stdSink() *sink {
+	return &sink{logger: newLogger(os.Stdout), direct: os.Stdout}
 }
 
-func newLogger(conf LogConfig) *syslog.Logger {
-	flag := syslog.Ldate | syslog.Ltime | syslog.Lmicroseconds
-	var output io.Writer
+/**
+* std输出到标准输出，file输出到按conf切割的文件
+ */
+func newSink(conf LogConfig) (*sink, error) {
+	s := &sink{
+		level:  stringToLevel(conf.Level),
+		format: conf.Format,
+	}
+	var output io.Writer = os.Stdout
 	if conf.Type == "file" {
-		path := path.Join(conf.Dir, conf.FileName)
-		fd, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		w, err := NewRotateWriter(conf)
 		if err != nil {
-			syslog.Fatal(err)
-			os.Exit(1)
+			return nil, err
 		}
-		output = fd
-	} else {
-		output = os.Stdout
+		output, s.writer = w, w
 	}
-
-	logger := syslog.New(output, "", flag)
-
-	return logger
+	if conf.Async {
+		s.async = NewAsyncWriter(output, conf.AsyncQueueSize, conf.AsyncPolicy)
+		output = s.async
+	}
+	s.logger = newLogger(output)
+	s.direct = output
+	return s, nil
 }
 
-func rotateDaemon() {
-	for {
-		time.Sleep(time.Second * 1)
-		// 切割
-		currentTime := getCurrentTime(l.config)
-		if currentTime != l.rotateTime {
-			os.Rename(l.config.FileName, l.config.FileName+fmt.Sprintf(".%s", l.rotateTime))
-			// 重新设置logger与rotateTime
-			// TODO：执行上一步后，下一步没执行前，其它goroutine会有问题吗？
-			SetLogger(newLogger(l.config))
-			SetRotateTime(currentTime)
+/**
+* 写出异步队列后关闭sink持有的文件，返回最后一个错误
+ */
+func closeSinks(sinks []*sink) (err error) {
+	for _, s := range sinks {
+		if s == nil {
+			continue
 		}
-
-		// 删除
-		files, err := ioutil.ReadDir(l.config.Dir)
-		// 保留n天
-		minKeepTime := time.Now().AddDate(0, 0, -l.config.KeepDays)
-		reg := regexp.MustCompile("\\.log\\.20[0-9]{8}")
-		if err == nil {
-			for _, file := range files {
-				if reg.FindString(file.Name()) != "" && shouldDel(file.Name(), minKeepTime) {
-					os.Remove(path.Join(l.config.Dir, file.Name()))
-				}
-			}
+		if s.async != nil {
+			s.async.Close()
+		}
+		if s.writer == nil {
+			continue
+		}
+		if e := s.writer.Close(); e != nil {
+			err = e
 		}
 	}
+	return err
+}
+
+/**
+* 时间、级别前缀等由encoder拼接，避免并发SetPrefix串行
+ */
+func newLogger(output io.Writer) *syslog.Logger {
+	return syslog.New(output, "", 0)
 }
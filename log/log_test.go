@@ -1,6 +1,21 @@
 package log
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	syslog "log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -25,3 +40,784 @@ func TestLog(t *testing.T) {
 	}
 
 }
+
+func TestJsonFormat(t *testing.T) {
+	conf := LogConfig{
+		Type:   "std",
+		Level:  "DEBUG",
+		Format: FORMAT_JSON,
+	}
+	buf := &bytes.Buffer{}
+	SetConfig(conf)
+	SetLogger(syslog.New(buf, "", 0))
+	SetTraceId("trace123")
+	defer SetTraceId("")
+
+	Info(map[string]interface{}{
+		"action": "test",
+		"cost":   1.5,
+		"err":    errors.New("failed"),
+	})
+	Warningf("hello %s", "world")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 lines, got %q", buf.String())
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["level"] != "INFO" || entry["trace_id"] != "trace123" || entry["action"] != "test" ||
+		entry["cost"] != 1.5 || entry["err"] != "failed" || !strings.Contains(entry["caller"].(string), "TestJsonFormat") {
+		t.Fatalf("unexpected entry %s", lines[0])
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil || entry["msg"] != "hello world" {
+		t.Fatalf("unexpected entry %s", lines[1])
+	}
+}
+
+func TestContextTraceId(t *testing.T) {
+	conf := LogConfig{
+		Type:   "std",
+		Level:  "DEBUG",
+		Format: FORMAT_JSON,
+	}
+	buf := &bytes.Buffer{}
+	SetConfig(conf)
+	SetLogger(syslog.New(buf, "", 0))
+	SetTraceId("global")
+	defer SetTraceId("")
+
+	ctx := NewContext(context.Background(), "request1")
+	if TraceIdFromContext(ctx) != "request1" {
+		t.Fatalf("unexpected trace id %s", TraceIdFromContext(ctx))
+	}
+	WithContext(ctx).Info(map[string]interface{}{"action": "test"})
+	WithContext(context.Background()).Infof("no trace")
+
+	var entry map[string]interface{}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil || entry["trace_id"] != "request1" ||
+		!strings.Contains(entry["caller"].(string), "TestContextTraceId") {
+		t.Fatalf("unexpected entry %s", lines[0])
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil || entry["trace_id"] != "global" {
+		t.Fatalf("unexpected entry %s", lines[1])
+	}
+}
+
+func TestRotateWriter(t *testing.T) {
+	dir := t.TempDir()
+	conf := LogConfig{
+		Type:      "file",
+		Dir:       dir,
+		FileName:  "test.log",
+		MaxSizeMB: 1,
+		KeepDays:  1,
+	}
+	w, err := NewRotateWriter(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	line := []byte(strings.Repeat("x", 1023) + "\n")
+	for i := 0; i < 1024+1; i++ {
+		if _, err := w.Write(line); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	var rotated []string
+	for _, file := range files {
+		if isRotatedFile(conf.FileName, file.Name()) {
+			rotated = append(rotated, path.Join(dir, file.Name()))
+		}
+	}
+	if len(rotated) != 2 {
+		t.Fatalf("expect 2 rotated files, got %v", rotated)
+	}
+	if info, err := os.Stat(path.Join(dir, conf.FileName)); err != nil || info.Size() != 0 {
+		t.Fatalf("expect empty current file, err=%v", err)
+	}
+
+	old := time.Now().AddDate(0, 0, -2)
+	os.Chtimes(rotated[0], old, old)
+	w.clean()
+	if _, err := os.Stat(rotated[0]); !os.IsNotExist(err) {
+		t.Fatalf("expect %s removed", rotated[0])
+	}
+
+	w.Close()
+	if _, err := w.Write(line); err != os.ErrClosed {
+		t.Fatalf("expect ErrClosed, got %v", err)
+	}
+}
+
+func TestRotateCompress(t *testing.T) {
+	dir := t.TempDir()
+	conf := LogConfig{
+		Type:           "file",
+		Dir:            dir,
+		FileName:       "test.log",
+		MaxBackups:     2,
+		MaxTotalSizeMB: 1,
+		Compress:       true,
+	}
+	w, err := NewRotateWriter(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		w.Write([]byte(strings.Repeat("x", 1024) + "\n"))
+		if err := w.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	w.clean()
+
+	backups := w.backups()
+	if len(backups) != 2 {
+		t.Fatalf("expect 2 backups, got %d", len(backups))
+	}
+	for _, file := range backups {
+		if !strings.HasSuffix(file.Name(), ".gz") {
+			t.Fatalf("expect %s compressed", file.Name())
+		}
+	}
+
+	// 超过总大小时只保留最新的
+	big := path.Join(dir, "test.log.20000101")
+	ioutil.WriteFile(big, bytes.Repeat([]byte("x"), 2*1024*1024), 0644)
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(big, old, old)
+	conf.Compress = false
+	conf.MaxBackups = 0
+	w.conf = conf
+	w.clean()
+	if _, err := os.Stat(big); !os.IsNotExist(err) {
+		t.Fatalf("expect %s removed", big)
+	}
+	if len(w.backups()) != 2 {
+		t.Fatalf("expect newer backups kept")
+	}
+}
+
+func TestLogger(t *testing.T) {
+	lg, err := New(LogConfig{
+		Type:   "std",
+		Level:  "INFO",
+		Format: FORMAT_JSON,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	lg.SetLogger(syslog.New(buf, "", 0))
+
+	child := lg.With(map[string]interface{}{"service": "golib", "module": "a"}).With(map[string]interface{}{"module": "b"})
+	child.Debug(map[string]interface{}{"action": "ignored"})
+	child.Info(map[string]interface{}{"action": "test"})
+	child.WithContext(NewContext(context.Background(), "request1")).Warningf("hello")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 lines, got %q", buf.String())
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil || entry["service"] != "golib" || entry["module"] != "b" ||
+		entry["action"] != "test" || !strings.Contains(entry["caller"].(string), "TestLogger") {
+		t.Fatalf("unexpected entry %s", lines[0])
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil || entry["service"] != "golib" ||
+		entry["trace_id"] != "request1" || entry["msg"] != "hello" {
+		t.Fatalf("unexpected entry %s", lines[1])
+	}
+
+	// 包级别函数输出到替换后的默认logger
+	old := Default()
+	SetDefault(child)
+	defer SetDefault(old)
+	buf.Reset()
+	Infof("default")
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil || entry["service"] != "golib" ||
+		!strings.Contains(entry["caller"].(string), "TestLogger") {
+		t.Fatalf("unexpected entry %s", buf.String())
+	}
+}
+
+func TestSinks(t *testing.T) {
+	dir := t.TempDir()
+	lg, err := New(LogConfig{
+		Level: "INFO",
+		Dir:   dir,
+		Sinks: []LogConfig{
+			{Type: "file", FileName: "app.log"},
+			{Type: "file", FileName: "app.log.wf", Level: "WARNING", Format: FORMAT_JSON},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg.Debug(map[string]interface{}{"action": "ignored"})
+	lg.Info(map[string]interface{}{"action": "info"})
+	lg.Warningf("warning")
+	lg.Close()
+
+	all, _ := ioutil.ReadFile(path.Join(dir, "app.log"))
+	lines := strings.Split(strings.TrimSpace(string(all)), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "【INFO】") || !strings.HasPrefix(lines[1], "【WARNING】") {
+		t.Fatalf("unexpected app.log %q", all)
+	}
+	wf, _ := ioutil.ReadFile(path.Join(dir, "app.log.wf"))
+	var entry map[string]interface{}
+	if err := json.Unmarshal(wf, &entry); err != nil || entry["msg"] != "warning" {
+		t.Fatalf("unexpected app.log.wf %q", wf)
+	}
+}
+
+/**
+* 第一次Write阻塞到release关闭，用于填满异步队列
+ */
+type blockingWriter struct {
+	buf     bytes.Buffer
+	started chan struct{}
+	release chan struct{}
+	mu      sync.Mutex
+}
+
+func (bw *blockingWriter) Write(p []byte) (int, error) {
+	select {
+	case bw.started <- struct{}{}:
+		<-bw.release
+	default:
+	}
+	bw.mu.Lock()
+	defer bw.mu.Unlock()
+	return bw.buf.Write(p)
+}
+
+func TestAsyncWriter(t *testing.T) {
+	for policy, expect := range map[string]string{
+		ASYNC_DROP_NEWEST: "0\n1\n2\n",
+		ASYNC_DROP_OLDEST: "0\n2\n3\n",
+	} {
+		bw := &blockingWriter{started: make(chan struct{}), release: make(chan struct{})}
+		aw := NewAsyncWriter(bw, 2, policy)
+		aw.Write([]byte("0\n"))
+		<-bw.started
+		for i := 1; i <= 3; i++ {
+			aw.Write([]byte(fmt.Sprintf("%d\n", i)))
+		}
+		if aw.Dropped() != 1 {
+			t.Fatalf("%s: expect 1 dropped, got %d", policy, aw.Dropped())
+		}
+		close(bw.release)
+		aw.Flush()
+		if bw.buf.String() != expect {
+			t.Fatalf("%s: expect %q, got %q", policy, expect, bw.buf.String())
+		}
+		aw.Close()
+	}
+
+	dir := t.TempDir()
+	lg, err := New(LogConfig{
+		Type:     "file",
+		Level:    "INFO",
+		Dir:      dir,
+		FileName: "async.log",
+		Async:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		lg.Infof("line %d", i)
+	}
+	lg.Close()
+	content, _ := ioutil.ReadFile(path.Join(dir, "async.log"))
+	if n := strings.Count(string(content), "\n"); n != 100 {
+		t.Fatalf("expect 100 lines, got %d", n)
+	}
+}
+
+func TestLevel(t *testing.T) {
+	dir := t.TempDir()
+	conf := path.Join(dir, "log.conf")
+	ioutil.WriteFile(conf, []byte(`{"Type": "std", "Level": "ERROR"}`), 0644)
+	lg, err := New(LogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lg.Close()
+	if err := lg.Reload(conf); err != nil || lg.GetLevel() != ERROR {
+		t.Fatalf("expect ERROR, got %s err=%v", lg.GetLevel(), err)
+	}
+
+	handler := &LevelHandler{Logger: lg}
+	req := httptest.NewRequest(http.MethodPut, "/log/level", strings.NewReader(`{"level": "debug"}`))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || lg.GetLevel() != DEBUG || !strings.Contains(rec.Body.String(), `"DEBUG"`) {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/log/level?level=verbose", nil))
+	if rec.Code != http.StatusBadRequest || lg.GetLevel() != DEBUG {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+
+	// 配置文件修改后自动重新加载
+	lg.StartWatch(conf, 10*time.Millisecond)
+	ioutil.WriteFile(conf, []byte(`{"Type": "std", "Level": "WARNING"}`), 0644)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(conf, later, later)
+	for i := 0; i < 100 && lg.GetLevel() != WARNING; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if lg.GetLevel() != WARNING {
+		t.Fatalf("expect WARNING after reload, got %s", lg.GetLevel())
+	}
+}
+
+/**
+* 并发写日志时反复Reload，旧的文件在进行中的写完成后才关闭，不丢日志
+ */
+func TestReloadNoLoss(t *testing.T) {
+	dir := t.TempDir()
+	conf := path.Join(dir, "log.conf")
+	ioutil.WriteFile(conf, []byte(`{"Type": "file", "Level": "INFO", "Dir": "`+dir+`", "FileName": "app.log", "Async": true}`), 0644)
+	lg, err := New(LogConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := lg.Reload(conf); err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 2000; j++ {
+				lg.Infof("line %d", j)
+			}
+		}()
+	}
+	stop := make(chan struct{})
+	reloaded := make(chan struct{})
+	go func() {
+		defer close(reloaded)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				lg.Reload(conf)
+			}
+		}
+	}()
+	wg.Wait()
+	close(stop)
+	<-reloaded
+	lg.Close()
+
+	content, err := ioutil.ReadFile(path.Join(dir, "app.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(content), "\n"); n != 8*2000 {
+		t.Fatalf("expect %d lines, got %d", 8*2000, n)
+	}
+}
+
+func TestSampleAndLimit(t *testing.T) {
+	lg, err := New(LogConfig{
+		Type:         "std",
+		Format:       FORMAT_JSON,
+		SampleKey:    "action",
+		SampleRate:   3,
+		SampleSlowMs: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	lg.SetLogger(syslog.New(buf, "", 0))
+
+	for i := 0; i < 6; i++ {
+		lg.Info(map[string]interface{}{"action": "redis_call", "cost": "1.00ms", "errmsg": ""})
+	}
+	lg.Info(map[string]interface{}{"action": "redis_call", "cost": "1.00ms", "errmsg": "timeout"})
+	lg.Info(map[string]interface{}{"action": "redis_call", "cost": "200.00ms", "errmsg": ""})
+	lg.Error(map[string]interface{}{"action": "redis_call"})
+	lg.Info(map[string]interface{}{"action": "http_call"})
+	if n := strings.Count(buf.String(), "\n"); n != 6 {
+		t.Fatalf("expect 6 lines, got %d: %s", n, buf.String())
+	}
+
+	lg, err = New(LogConfig{
+		Type:      "std",
+		RateLimit: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	lg.SetLogger(syslog.New(buf, "", 0))
+	for i := 0; i < 5; i++ {
+		lg.Infof("line %d", i)
+	}
+	if n := strings.Count(buf.String(), "\n"); n != 2 || lg.Limited() != 3 {
+		t.Fatalf("expect 2 lines and 3 limited, got %d lines %d limited", n, lg.Limited())
+	}
+}
+
+func TestRedact(t *testing.T) {
+	lg, err := New(LogConfig{
+		Type:         "std",
+		Format:       FORMAT_JSON,
+		RedactKeys:   []string{"password|token"},
+		RedactValues: []string{`1[3-9]\d{9}`},
+		RedactStyle:  REDACT_PARTIAL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	lg.SetLogger(syslog.New(buf, "", 0))
+
+	params := map[string]interface{}{"user": "tom", "Password": "secret123", "phone": "13812345678"}
+	lg.Info(map[string]interface{}{
+		"action": "http_call",
+		"params": params,
+		"sql":    "UPDATE `users` SET `password` = 'abc123456', `name` = 'tom' WHERE access_token = \"tk-000111\"",
+	})
+	lg.Infof("call %s", "13812345678")
+	if params["Password"] != "secret123" {
+		t.Fatalf("params should not be modified")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	var entry struct {
+		Params map[string]string `json:"params"`
+		Sql    string            `json:"sql"`
+		Msg    string            `json:"msg"`
+	}
+	json.Unmarshal([]byte(lines[0]), &entry)
+	if entry.Params["user"] != "tom" || entry.Params["Password"] != "sec***123" || entry.Params["phone"] != "138*****678" {
+		t.Fatalf("unexpected params %v", entry.Params)
+	}
+	if entry.Sql != "UPDATE `users` SET `password` = 'abc***456', `name` = 'tom' WHERE access_token = \"tk-***111\"" {
+		t.Fatalf("unexpected sql %s", entry.Sql)
+	}
+	json.Unmarshal([]byte(lines[1]), &entry)
+	if entry.Msg != "call 138*****678" {
+		t.Fatalf("unexpected msg %s", entry.Msg)
+	}
+
+	// gorm的INSERT按列的位置打码，值中的逗号、括号不影响分隔
+	buf.Reset()
+	lg.Info(map[string]interface{}{
+		"sql": "INSERT INTO `users` (`name`,`password`,`created_at`) VALUES ('tom','secret3',NOW()),('a, (b)','it''s-secret',NULL)",
+	})
+	json.Unmarshal(buf.Bytes(), &entry)
+	if entry.Sql != "INSERT INTO `users` (`name`,`password`,`created_at`) VALUES ('tom','se***t3',NOW()),('a, (b)','it''****cret',NULL)" {
+		t.Fatalf("unexpected sql %s", entry.Sql)
+	}
+
+	if _, err := New(LogConfig{RedactValues: []string{"("}}); err == nil {
+		t.Fatal("expect invalid regexp error")
+	}
+}
+
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (sb *syncBuffer) Write(p []byte) (int, error) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.Write(p)
+}
+
+func (sb *syncBuffer) String() string {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+	return sb.buf.String()
+}
+
+func logWrapper(lg *Logger, msg string) {
+	lg.Errorf("%s", msg)
+}
+
+func TestCallerAndRecover(t *testing.T) {
+	lg, err := New(LogConfig{
+		Type:       "std",
+		Format:     FORMAT_JSON,
+		CallerSkip: 1,
+		StackLevel: "ERROR",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &syncBuffer{}
+	lg.SetLogger(syslog.New(buf, "", 0))
+
+	logWrapper(lg, "wrapped")
+	lg.WithCallerSkip(-1).Info(map[string]interface{}{"action": "direct"})
+
+	var entry map[string]interface{}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil || !strings.Contains(entry["caller"].(string), "TestCallerAndRecover") ||
+		!strings.Contains(entry["stack"].(string), "TestCallerAndRecover") {
+		t.Fatalf("unexpected entry %s", lines[0])
+	}
+	entry = nil
+	if err := json.Unmarshal([]byte(lines[1]), &entry); err != nil || !strings.Contains(entry["caller"].(string), "TestCallerAndRecover") ||
+		entry["stack"] != nil {
+		t.Fatalf("unexpected entry %s", lines[1])
+	}
+
+	func() {
+		defer lg.WithContext(NewContext(context.Background(), "request1")).Recover()
+		var m map[string]int
+		m["a"] = 1
+	}()
+	lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if err := json.Unmarshal([]byte(lines[2]), &entry); err != nil || entry["action"] != "panic" || entry["trace_id"] != "request1" ||
+		!strings.Contains(entry["caller"].(string), "TestCallerAndRecover.func") {
+		t.Fatalf("unexpected entry %s", lines[2])
+	}
+
+	lg.GoSafe(func() {
+		panic("boom")
+	})
+	for i := 0; i < 100 && !strings.Contains(buf.String(), "boom"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !strings.Contains(buf.String(), `"errmsg":"boom"`) {
+		t.Fatalf("expect panic logged, got %s", buf.String())
+	}
+}
+
+func TestHooks(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+
+	// 先占用端口再关闭，forwarder启动时连不上，日志留在本地队列
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := tcp.Addr().String()
+	tcp.Close()
+
+	lg, err := New(LogConfig{Type: "std", Level: "INFO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lg.SetLogger(syslog.New(ioutil.Discard, "", 0))
+	syslogHook := NewSyslogHook("udp", udp.LocalAddr().String(), "golib")
+	syslogHook.Level = WARNING
+	forwardHook := NewForwardHook(addr, 10)
+	forwardHook.ReconnectMs = 10
+	lg.AddHook(syslogHook)
+	lg.AddHook(forwardHook)
+
+	ctx := NewContext(context.Background(), "request1")
+	lg.WithContext(ctx).Info(map[string]interface{}{"action": "redis_call"})
+	lg.WithContext(ctx).Warning(map[string]interface{}{"action": "redis_call"})
+	lg.Infof("hello")
+
+	packet := make([]byte, 4096)
+	udp.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := udp.ReadFrom(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(packet[:n])
+	if !strings.HasPrefix(msg, "<132>1 ") || !strings.Contains(msg, ` golib `) ||
+		!strings.Contains(msg, ` redis_call [golib@32473 trace_id="request1"] {`) {
+		t.Fatalf("unexpected syslog message %s", msg)
+	}
+
+	tcp, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("port %s reused: %s", addr, err.Error())
+	}
+	defer tcp.Close()
+	conn, err := tcp.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	reader := bufio.NewReader(conn)
+	for _, expect := range []string{`"action":"redis_call"`, `"action":"redis_call"`, `"msg":"hello"`} {
+		line, err := reader.ReadString('\n')
+		if err != nil || !strings.Contains(line, expect) {
+			t.Fatalf("expect %s, got %q err=%v", expect, line, err)
+		}
+	}
+	// Sync等待Hook队列发送完，Fatal退出前的日志不丢失
+	lg.Errorf("bye")
+	if err := lg.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if line, err := reader.ReadString('\n'); err != nil || !strings.Contains(line, `"msg":"bye"`) {
+		t.Fatalf("expect bye, got %q err=%v", line, err)
+	}
+	lg.Close()
+
+	// 收集服务不可达时日志不等待连接
+	blocked, err := New(LogConfig{Type: "std", Level: "INFO"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocked.SetLogger(syslog.New(ioutil.Discard, "", 0))
+	blackhole := NewSyslogHook("tcp", "10.255.255.1:514", "golib")
+	blackhole.ConnTimeoutMs = 300
+	blocked.AddHook(blackhole)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		blocked.Warningf("hello %d", i)
+	}
+	if cost := time.Since(start); cost > 200*time.Millisecond {
+		t.Fatalf("logging blocked by syslog hook for %s", cost)
+	}
+	// 远程不可用时Sync最多等待HOOK_FLUSH_TIMEOUT_MS
+	down, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	down.Close()
+	blocked.AddHook(NewForwardHook(down.Addr().String(), 0))
+	blocked.Warningf("hello")
+	start = time.Now()
+	if err := blocked.Sync(); err != ErrFlushTimeout || time.Since(start) > 2*time.Duration(HOOK_FLUSH_TIMEOUT_MS)*time.Millisecond {
+		t.Fatalf("expect ErrFlushTimeout, got %v after %s", err, time.Since(start))
+	}
+	blocked.Close()
+}
+
+func TestFields(t *testing.T) {
+	lg, err := New(LogConfig{
+		Type:   "std",
+		Level:  "INFO",
+		Format: FORMAT_JSON,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := &bytes.Buffer{}
+	lg.SetLogger(syslog.New(buf, "", 0))
+
+	child := lg.WithFields(String("service", "golib"), String("module", "a"))
+	child.DebugFields(String("action", "ignored"))
+	child.InfoFields(String("module", "b"), String("action", "redis_call"), Int("retry", 2),
+		Duration("cost", 1500*time.Microsecond), Bool("hit", true), Err(errors.New("timeout")))
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil || entry["service"] != "golib" || entry["module"] != "b" ||
+		entry["action"] != "redis_call" || entry["retry"] != 2.0 || entry["cost"] != "1.50ms" || entry["hit"] != true ||
+		entry["errmsg"] != "timeout" || !strings.Contains(entry["caller"].(string), "TestFields") {
+		t.Fatalf("unexpected entry %s", buf.String())
+	}
+
+	r := &record{
+		time:    time.Date(2019, 7, 10, 16, 5, 12, 0, time.Local),
+		level:   WARNING,
+		caller:  "log/log_test.go:1::TestFields",
+		traceId: "request1",
+		msg:     "hello",
+		fields:  []Field{String("action", "a\"b"), Int64("count", 3), Float64("rate", 0.5), Err(nil)},
+	}
+	text := string(appendTextRecord(nil, r))
+	expect := "【WARNING】2019/07/10 16:05:12.000000 [log/log_test.go:1::TestFields] action=a\"b||count=3||rate=0.5||errmsg=||trace_id=request1||hello\n"
+	if text != expect {
+		t.Fatalf("expect %q, got %q", expect, text)
+	}
+	if err := json.Unmarshal(appendJsonRecord(nil, r), &entry); err != nil || entry["action"] != "a\"b" || entry["count"] != 3.0 ||
+		entry["rate"] != 0.5 || entry["errmsg"] != "" || entry["msg"] != "hello" {
+		t.Fatalf("unexpected entry %v err=%v", entry, err)
+	}
+
+	// 与固定字段同名的字段加前缀，不覆盖
+	r.fields = append(r.fields, String("level", "fake"), String("msg", "fake"))
+	entry = nil
+	if err := json.Unmarshal(appendJsonRecord(nil, r), &entry); err != nil || entry["level"] != "WARNING" || entry["msg"] != "hello" ||
+		entry["fields.level"] != "fake" || entry["fields.msg"] != "fake" {
+		t.Fatalf("unexpected entry %v err=%v", entry, err)
+	}
+
+	// nil指针的error同%v输出<nil>，不panic，也不算作错误
+	var nilErr *testError
+	buf.Reset()
+	lg.Info(map[string]interface{}{"err": error(nilErr), "value": nilErr})
+	entry = nil
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil || entry["err"] != "<nil>" || entry["value"] != "<nil>" {
+		t.Fatalf("unexpected entry %s", buf.String())
+	}
+	nilFields := []Field{Any("err", error(nilErr))}
+	if text := string(appendTextRecord(nil, &record{fields: nilFields})); !strings.Contains(text, "err=<nil>") {
+		t.Fatalf("unexpected text %q", text)
+	}
+	if hasError(nilFields) {
+		t.Fatal("expect nil pointer error not counted as error")
+	}
+	redactor, _ := newRedactor(LogConfig{RedactKeys: []string{"password"}})
+	if v := redactor.redactValue(error(nilErr)); v != "<nil>" {
+		t.Fatalf("unexpected redacted value %v", v)
+	}
+
+	// 复用缓冲区，编码不分配内存
+	if raceEnabled {
+		return
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, format := range []string{FORMAT_TEXT, FORMAT_JSON} {
+			putbuf(encode(format, r))
+		}
+	})
+	if allocs > 0 {
+		t.Fatalf("expect no allocation, got %v", allocs)
+	}
+
+	// typed字段输出到文件，包括caller、合并固定字段以及可变参数，不分配内存
+	for _, format := range []string{FORMAT_TEXT, FORMAT_JSON} {
+		fileLg, err := New(LogConfig{Type: "file", Dir: t.TempDir(), FileName: "fields.log", Level: "INFO", Format: format})
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileChild := fileLg.WithFields(String("service", "golib"))
+		allocs = testing.AllocsPerRun(100, func() {
+			fileLg.InfoFields(String("action", "redis_call"), Int("retry", 2))
+			fileChild.InfoFields(String("action", "redis_call"), Duration("cost", time.Millisecond), Err(nil))
+		})
+		fileLg.Close()
+		if allocs > 0 {
+			t.Fatalf("expect InfoFields no allocation in %s format, got %v", format, allocs)
+		}
+	}
+}
+
+type testError struct {
+	msg string
+}
+
+func (e *testError) Error() string {
+	return e.msg
+}
@@ -0,0 +1,215 @@
+package log
+
+import (
+	"context"
+	syslog "log"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Logger 日志实例，各个库可以持有自己的级别与输出
+// With派生的子logger携带固定字段，与父logger共享输出、级别以及trace_id
+type Logger struct {
+	out    *Log
+	fields []Field // 固定字段，每条日志都会带上
+	skip   int     // WithCallerSkip额外跳过的调用层数
+}
+
+var (
+	defaultLogger *Logger
+	defaultMu     sync.RWMutex
+)
+
+func init() {
+	// 设置默认输出logger
+	lg, _ := New(LogConfig{
+		Type: "std",
+	})
+	SetDefault(lg)
+}
+
+/**
+* 按配置创建logger，Type为file时打开日志文件
+ */
+func New(conf LogConfig) (*Logger, error) {
+	lg := &Logger{out: &Log{}}
+	if err := lg.out.setup(conf); err != nil {
+		return nil, err
+	}
+	return lg, nil
+}
+
+/**
+* 包级别的日志函数输出到的logger
+ */
+func Default() *Logger {
+	defaultMu.RLock()
+	defer defaultMu.RUnlock()
+	return defaultLogger
+}
+
+/**
+* 替换默认logger，之后Init/SetConfig等包级别函数作用于新logger
+ */
+func SetDefault(lg *Logger) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultLogger = lg
+}
+
+/**
+* 派生携带固定字段的子logger，与父logger同名的字段以fields为准
+ */
+func (lg *Logger) With(fields map[string]interface{}) *Logger {
+	return lg.WithFields(mapFields(fields)...)
+}
+
+func (lg *Logger) WithFields(fields ...Field) *Logger {
+	return &Logger{
+		out:    lg.out,
+		fields: appendFields(nil, lg.fields, fields),
+		skip:   lg.skip,
+	}
+}
+
+/**
+* 派生caller多跳过skip层的子logger，用于封装了日志函数的场景
+ */
+func (lg *Logger) WithCallerSkip(skip int) *Logger {
+	return &Logger{
+		out:    lg.out,
+		fields: lg.fields,
+		skip:   lg.skip + skip,
+	}
+}
+
+/**
+* ctx中没有trace_id时退化为SetTraceId设置的值
+ */
+func (lg *Logger) WithContext(ctx context.Context) *ContextLogger {
+	traceId := TraceIdFromContext(ctx)
+	if traceId == "" {
+		traceId = lg.out.getTraceId()
+	}
+	return &ContextLogger{logger: lg, traceId: traceId}
+}
+
+// 以下设置作用于logger以及与其共享输出的父/子logger
+
+func (lg *Logger) SetTraceId(traceId string) {
+	lg.out.mu.Lock()
+	defer lg.out.mu.Unlock()
+	lg.out.traceId = traceId
+}
+
+func (lg *Logger) SetConfig(conf LogConfig) {
+	lg.out.mu.Lock()
+	defer lg.out.mu.Unlock()
+	lg.out.storeConfig(conf)
+}
+
+/**
+* 替换输出，配置的Sinks会被关闭
+ */
+func (lg *Logger) SetLogger(logger *syslog.Logger) {
+	lg.out.setLogger(logger)
+}
+
+/**
+* 关闭日志文件并停止后台清理，之后输出到标准输出
+ */
+func (lg *Logger) Close() error {
+	return lg.out.close()
+}
+
+/**
+* 等待异步队列中的日志写出并刷盘，Fatal退出前会调用
+* 同时等待Hook队列发送完，远程不可用时最多等待HOOK_FLUSH_TIMEOUT_MS，超时返回ErrFlushTimeout
+ */
+func (lg *Logger) Sync() error {
+	return lg.out.sync()
+}
+
+/**
+* 异步队列满时丢弃的日志行数
+ */
+func (lg *Logger) Dropped() int64 {
+	return lg.out.dropped()
+}
+
+/**
+* 超过RateLimit被丢弃的日志行数
+ */
+func (lg *Logger) Limited() int64 {
+	return atomic.LoadInt64(&lg.out.limited)
+}
+
+func (lg *Logger) Debug(args map[string]interface{}) {
+	lg.print(lg.out.getTraceId(), DEBUG, args)
+}
+
+func (lg *Logger) Debugf(format string, args ...interface{}) {
+	lg.printf(lg.out.getTraceId(), DEBUG, format, args...)
+}
+
+func (lg *Logger) Info(args map[string]interface{}) {
+	lg.print(lg.out.getTraceId(), INFO, args)
+}
+
+func (lg *Logger) Infof(format string, args ...interface{}) {
+	lg.printf(lg.out.getTraceId(), INFO, format, args...)
+}
+
+func (lg *Logger) Warning(args map[string]interface{}) {
+	lg.print(lg.out.getTraceId(), WARNING, args)
+}
+
+func (lg *Logger) Warningf(format string, args ...interface{}) {
+	lg.printf(lg.out.getTraceId(), WARNING, format, args...)
+}
+
+func (lg *Logger) Error(args map[string]interface{}) {
+	lg.print(lg.out.getTraceId(), ERROR, args)
+}
+
+func (lg *Logger) Errorf(format string, args ...interface{}) {
+	lg.printf(lg.out.getTraceId(), ERROR, format, args...)
+}
+
+func (lg *Logger) Fatal(args map[string]interface{}) {
+	lg.print(lg.out.getTraceId(), FATAL, args)
+	lg.Sync()
+	os.Exit(1)
+}
+
+func (lg *Logger) Fatalf(format string, args ...interface{}) {
+	lg.printf(lg.out.getTraceId(), FATAL, format, args...)
+	lg.Sync()
+	os.Exit(1)
+}
+
+// 以下为typed字段输出，不需要构造map
+// log.InfoFields(log.String("action", "redis_call"), log.Duration("cost", cost), log.Err(err))
+
+func (lg *Logger) DebugFields(fields ...Field) {
+	lg.output(3, "", lg.out.getTraceId(), DEBUG, "", fields)
+}
+
+func (lg *Logger) InfoFields(fields ...Field) {
+	lg.output(3, "", lg.out.getTraceId(), INFO, "", fields)
+}
+
+func (lg *Logger) WarningFields(fields ...Field) {
+	lg.output(3, "", lg.out.getTraceId(), WARNING, "", fields)
+}
+
+func (lg *Logger) ErrorFields(fields ...Field) {
+	lg.output(3, "", lg.out.getTraceId(), ERROR, "", fields)
+}
+
+func (lg *Logger) FatalFields(fields ...Field) {
+	lg.output(3, "", lg.out.getTraceId(), FATAL, "", fields)
+	lg.Sync()
+	os.Exit(1)
+}
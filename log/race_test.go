@@ -0,0 +1,6 @@
+//go:build race
+
+package log
+
+// race检测会额外分配内存
+const raceEnabled = true
@@ -0,0 +1,83 @@
+package log
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// panic恢复，记录ERROR日志(action=panic)以及panic处的调用栈，不再导致进程退出
+// 必须直接defer调用：defer log.Recover()
+
+func Recover() {
+	if r := recover(); r != nil {
+		lg := Default()
+		lg.logPanic(lg.out.getTraceId(), r)
+	}
+}
+
+/**
+* 在新的goroutine中执行fn，panic时记录日志
+ */
+func GoSafe(fn func()) {
+	Default().GoSafe(fn)
+}
+
+func (lg *Logger) Recover() {
+	if r := recover(); r != nil {
+		lg.logPanic(lg.out.getTraceId(), r)
+	}
+}
+
+func (lg *Logger) GoSafe(fn func()) {
+	go func() {
+		defer lg.Recover()
+		fn()
+	}()
+}
+
+/**
+* 使用ctx中的trace_id记录panic
+ */
+func (cl *ContextLogger) Recover() {
+	if r := recover(); r != nil {
+		cl.logger.logPanic(cl.traceId, r)
+	}
+}
+
+func (cl *ContextLogger) GoSafe(fn func()) {
+	go func() {
+		defer cl.Recover()
+		fn()
+	}()
+}
+
+/**
+* caller以及stack从panic发生处开始
+ */
+func (lg *Logger) logPanic(traceId string, r interface{}) {
+	frames := panicFrames()
+	lg.output(0, formatFrames(frames[:1]), traceId, ERROR, "", []Field{
+		String("action", "panic"),
+		String("errmsg", fmt.Sprintf("%v", r)),
+		String("stack", formatFrames(frames)),
+	})
+}
+
+/**
+* 跳过runtime.gopanic及之前的帧，以及运行时错误(空指针等)引发panic的runtime帧
+ */
+func panicFrames() []runtime.Frame {
+	frames := callerFrames(1)
+	for i, frame := range frames {
+		if frame.Function != "runtime.gopanic" || i+1 == len(frames) {
+			continue
+		}
+		frames = frames[i+1:]
+		for len(frames) > 1 && strings.HasPrefix(frames[0].Function, "runtime.") {
+			frames = frames[1:]
+		}
+		return frames
+	}
+	return frames
+}
@@ -0,0 +1,308 @@
+package log
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 打码方式
+const (
+	REDACT_FULL    string = "full"    // 整体替换为******
+	REDACT_PARTIAL string = "partial" // 保留首尾各1/3，如 138*****678
+	REDACT_HASH    string = "hash"    // sha256前16位，相同的值可以关联
+)
+
+const REDACT_MASK string = "******"
+
+// sql中的 column = 'value' / column = 123，column匹配RedactKeys时value打码
+var sqlAssignRegexp = regexp.MustCompile("(?i)(`?(\\w+)`?\\s*(?:=|<>|!=|\\blike\\b)\\s*)('(?:[^'\\\\]|\\\\.)*'|\"(?:[^\"\\\\]|\\\\.)*\"|-?\\d+(?:\\.\\d+)?)")
+
+// INSERT INTO table (col1, col2) VALUES，第1组为列名列表，之后是值的元组
+var sqlInsertRegexp = regexp.MustCompile("(?i)\\binsert\\s+(?:ignore\\s+)?into\\s+[`\"\\w.]+\\s*\\(([^)]*)\\)\\s*values\\s*")
+
+// redactor 输出前对map字段、sql以及格式化输出的内容打码
+type redactor struct {
+	keys   []*regexp.Regexp // 字段名匹配时整个值打码
+	values []*regexp.Regexp // 字符串中匹配的部分打码
+	style  string
+}
+
+/**
+* 未配置RedactKeys/RedactValues时返回nil，正则错误时返回错误
+ */
+func newRedactor(conf LogConfig) (*redactor, error) {
+	if len(conf.RedactKeys) == 0 && len(conf.RedactValues) == 0 {
+		return nil, nil
+	}
+	r := &redactor{style: conf.RedactStyle}
+	for _, pattern := range conf.RedactKeys {
+		re, err := regexp.Compile("(?i)" + pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RedactKeys %q: %s", pattern, err.Error())
+		}
+		r.keys = append(r.keys, re)
+	}
+	for _, pattern := range conf.RedactValues {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RedactValues %q: %s", pattern, err.Error())
+		}
+		r.values = append(r.values, re)
+	}
+	return r, nil
+}
+
+/**
+* 返回打码后的新map，不修改参数，嵌套的map同样处理
+ */
+func (r *redactor) redactMap(m map[string]interface{}) map[string]interface{} {
+	if m == nil {
+		return nil
+	}
+	redacted := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		switch {
+		case r.isSensitiveKey(k):
+			redacted[k] = r.mask(fmt.Sprintf("%v", v))
+		case k == "sql":
+			if sql, ok := v.(string); ok {
+				redacted[k] = r.redactString(r.redactSql(sql))
+			} else {
+				redacted[k] = r.redactValue(v)
+			}
+		default:
+			redacted[k] = r.redactValue(v)
+		}
+	}
+	return redacted
+}
+
+/**
+* 返回打码后的新切片
+ */
+func (r *redactor) redactFields(fields []Field) []Field {
+	if len(fields) == 0 {
+		return fields
+	}
+	redacted := make([]Field, len(fields))
+	for i, f := range fields {
+		switch {
+		case r.isSensitiveKey(f.Key):
+			redacted[i] = String(f.Key, r.mask(string(f.appendText(nil))))
+		case f.typ == stringType && f.Key == "sql":
+			redacted[i] = String(f.Key, r.redactString(r.redactSql(f.str)))
+		case f.typ == stringType:
+			redacted[i] = String(f.Key, r.redactString(f.str))
+		case f.typ == errorType && f.val != nil, f.typ == anyType:
+			redacted[i] = Any(f.Key, r.redactValue(f.val))
+		default:
+			redacted[i] = f
+		}
+	}
+	return redacted
+}
+
+func (r *redactor) redactValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case string:
+		return r.redactString(value)
+	case map[string]interface{}:
+		return r.redactMap(value)
+	case map[string]string:
+		redacted := make(map[string]string, len(value))
+		for k, s := range value {
+			if r.isSensitiveKey(k) {
+				redacted[k] = r.mask(s)
+			} else {
+				redacted[k] = r.redactString(s)
+			}
+		}
+		return redacted
+	case error:
+		return r.redactString(errorText(value))
+	case fmt.Stringer:
+		return r.redactString(stringerText(value))
+	}
+	return v
+}
+
+func (r *redactor) redactString(s string) string {
+	for _, re := range r.values {
+		s = re.ReplaceAllStringFunc(s, r.mask)
+	}
+	return s
+}
+
+/**
+* 条件、赋值以及INSERT中列名匹配RedactKeys的值打码，保留引号
+ */
+func (r *redactor) redactSql(sql string) string {
+	if len(r.keys) == 0 {
+		return sql
+	}
+	sql = sqlAssignRegexp.ReplaceAllStringFunc(sql, func(match string) string {
+		sub := sqlAssignRegexp.FindStringSubmatch(match)
+		if !r.isSensitiveKey(sub[2]) {
+			return match
+		}
+		return sub[1] + r.maskSqlValue(sub[3])
+	})
+	return r.redactSqlInsert(sql)
+}
+
+/**
+* INSERT的VALUES元组中按列的位置打码，支持多个元组
+ */
+func (r *redactor) redactSqlInsert(sql string) string {
+	locs := sqlInsertRegexp.FindAllStringSubmatchIndex(sql, -1)
+	if len(locs) == 0 {
+		return sql
+	}
+	b := &strings.Builder{}
+	last := 0
+	for _, loc := range locs {
+		if loc[0] < last {
+			continue
+		}
+		columns := strings.Split(sql[loc[2]:loc[3]], ",")
+		sensitive := make([]bool, len(columns))
+		found := false
+		for i, column := range columns {
+			sensitive[i] = r.isSensitiveKey(strings.Trim(strings.TrimSpace(column), "`\""))
+			found = found || sensitive[i]
+		}
+		b.WriteString(sql[last:loc[1]])
+		last = loc[1]
+		if found {
+			last = r.redactSqlTuples(b, sql, last, sensitive)
+		}
+	}
+	b.WriteString(sql[last:])
+	return b.String()
+}
+
+/**
+* 从pos开始逐个读取 (v1, v2), (v3, v4) 写入b，sensitive对应位置的值打码，返回元组结束的位置
+* 字符串中的括号、逗号以及函数调用的参数不影响分隔
+ */
+func (r *redactor) redactSqlTuples(b *strings.Builder, sql string, pos int, sensitive []bool) int {
+	i := pos
+	for i < len(sql) && sql[i] == '(' {
+		b.WriteByte('(')
+		i++
+		column, start, depth := 0, i, 0
+		flush := func() {
+			if column < len(sensitive) && sensitive[column] {
+				b.WriteString(r.maskSqlValue(sql[start:i]))
+			} else {
+				b.WriteString(sql[start:i])
+			}
+			column++
+		}
+		for i < len(sql) {
+			c := sql[i]
+			if c == '\'' || c == '"' {
+				i = skipSqlQuoted(sql, i)
+				continue
+			}
+			if c == '(' {
+				depth++
+			} else if c == ')' && depth > 0 {
+				depth--
+			} else if c == ')' {
+				break
+			} else if c == ',' && depth == 0 {
+				flush()
+				b.WriteByte(',')
+				start = i + 1
+			}
+			i++
+		}
+		flush()
+		if i == len(sql) {
+			return i
+		}
+		b.WriteByte(')')
+		i++
+
+		// 下一个元组
+		next := i
+		for next < len(sql) && (sql[next] == ' ' || sql[next] == '\t' || sql[next] == '\n') {
+			next++
+		}
+		if next == len(sql) || sql[next] != ',' {
+			return i
+		}
+		next++
+		for next < len(sql) && (sql[next] == ' ' || sql[next] == '\t' || sql[next] == '\n') {
+			next++
+		}
+		b.WriteString(sql[i:next])
+		i = next
+	}
+	return i
+}
+
+/**
+* 引号开始的位置，返回结束引号之后的位置，支持 \' 以及 '' 转义
+ */
+func skipSqlQuoted(sql string, i int) int {
+	quote := sql[i]
+	for i++; i < len(sql); i++ {
+		switch sql[i] {
+		case '\\':
+			i++
+		case quote:
+			if i+1 < len(sql) && sql[i+1] == quote {
+				i++
+				continue
+			}
+			return i + 1
+		}
+	}
+	return len(sql)
+}
+
+/**
+* 保留值两侧的空白以及引号，数字等未加引号的值打码后加上单引号，NULL不处理
+ */
+func (r *redactor) maskSqlValue(value string) string {
+	trimmed := strings.TrimSpace(value)
+	if trimmed == "" || strings.EqualFold(trimmed, "null") {
+		return value
+	}
+	left := value[:strings.Index(value, trimmed)]
+	right := value[len(left)+len(trimmed):]
+	if quote := trimmed[0]; (quote == '\'' || quote == '"') && len(trimmed) >= 2 && trimmed[len(trimmed)-1] == quote {
+		return left + string(quote) + r.mask(trimmed[1:len(trimmed)-1]) + string(quote) + right
+	}
+	return left + "'" + r.mask(trimmed) + "'" + right
+}
+
+func (r *redactor) isSensitiveKey(key string) bool {
+	for _, re := range r.keys {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) mask(s string) string {
+	switch r.style {
+	case REDACT_PARTIAL:
+		runes := []rune(s)
+		keep := len(runes) / 3
+		if len(runes) <= 4 || keep == 0 {
+			return REDACT_MASK
+		}
+		return string(runes[:keep]) + strings.Repeat("*", len(runes)-2*keep) + string(runes[len(runes)-keep:])
+	case REDACT_HASH:
+		sum := sha256.Sum256([]byte(s))
+		return "sha256:" + hex.EncodeToString(sum[:])[:16]
+	}
+	return REDACT_MASK
+}
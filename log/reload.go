@@ -0,0 +1,79 @@
+package log
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+/**
+* 重新读取配置文件，替换级别与输出，之前打开的日志文件会被关闭
+ */
+func (lg *Logger) Reload(path string) error {
+	conf, err := loadConfig(path)
+	if err != nil {
+		return err
+	}
+	return lg.out.setup(conf)
+}
+
+/**
+* 默认logger监听配置文件
+ */
+func StartWatch(path string, interval time.Duration) {
+	Default().StartWatch(path, interval)
+}
+
+/**
+* 后台每interval检查一次配置文件修改时间，变化或收到SIGHUP时Reload，Close时停止
+* interval<=0时默认1s，重复调用无效
+ */
+func (lg *Logger) StartWatch(path string, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	lg.out.mu.Lock()
+	defer lg.out.mu.Unlock()
+	if lg.out.stopWatch != nil {
+		return
+	}
+	lg.out.stopWatch = make(chan struct{})
+	go lg.watch(path, fileModTime(path), interval, lg.out.stopWatch)
+}
+
+func (lg *Logger) watch(path string, modTime time.Time, interval time.Duration, stop chan struct{}) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-hup:
+		case <-ticker.C:
+			t := fileModTime(path)
+			if t.Equal(modTime) {
+				continue
+			}
+			modTime = t
+		}
+		if err := lg.Reload(path); err != nil {
+			lg.Warning(map[string]interface{}{
+				"action": "log_reload",
+				"errmsg": err.Error(),
+			})
+		}
+	}
+}
+
+func fileModTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
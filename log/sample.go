@@ -0,0 +1,168 @@
+package log
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sampler 按字段值采样，同一值每秒第一条之后每rate条记录1条
+// 错误以及慢调用总是记录
+type sampler struct {
+	key         string
+	rate        uint64
+	slowMs      float64
+	counts      map[string]uint64 // 当前窗口内各值出现次数
+	windowStart time.Time
+	mu          sync.Mutex
+}
+
+func newSampler(conf LogConfig) *sampler {
+	if conf.SampleKey == "" || conf.SampleRate <= 1 {
+		return nil
+	}
+	return &sampler{
+		key:    conf.SampleKey,
+		rate:   uint64(conf.SampleRate),
+		slowMs: float64(conf.SampleSlowMs),
+		counts: make(map[string]uint64),
+	}
+}
+
+/**
+* 是否记录，没有采样字段的日志总是记录
+ */
+func (s *sampler) sample(level Level, fields []Field) bool {
+	if level <= ERROR {
+		return true
+	}
+	i := indexField(fields, s.key)
+	if i < 0 || hasError(fields) || s.isSlow(fields) {
+		return true
+	}
+	key := string(fields[i].appendText(nil))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// 每秒重置，同时限制counts的大小
+	now := time.Now()
+	if now.Sub(s.windowStart) >= time.Second {
+		s.counts = make(map[string]uint64)
+		s.windowStart = now
+	}
+	n := s.counts[key]
+	s.counts[key] = n + 1
+
+	return n%s.rate == 0
+}
+
+func (s *sampler) isSlow(fields []Field) bool {
+	if s.slowMs <= 0 {
+		return false
+	}
+	i := indexField(fields, "cost")
+	if i < 0 {
+		return false
+	}
+	cost, ok := fieldCostMs(fields[i])
+	return ok && cost >= s.slowMs
+}
+
+/**
+* errmsg/err字段不为空
+ */
+func hasError(fields []Field) bool {
+	for _, key := range []string{"errmsg", "err"} {
+		i := indexField(fields, key)
+		if i < 0 {
+			continue
+		}
+		switch f := fields[i]; f.typ {
+		case stringType:
+			if f.str != "" {
+				return true
+			}
+		case errorType, anyType:
+			if !isNilValue(f.val) {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+/**
+* cost字段转为毫秒，支持Duration、数字(ms)以及helper.FormatDurationToMs输出的"1.23ms"
+ */
+func fieldCostMs(f Field) (float64, bool) {
+	switch f.typ {
+	case durationType:
+		return float64(f.num) / float64(time.Millisecond), true
+	case intType:
+		return float64(f.num), true
+	case floatType:
+		return f.Value().(float64), true
+	case stringType:
+		return costMs(f.str)
+	}
+	return costMs(f.val)
+}
+
+func costMs(cost interface{}) (float64, bool) {
+	switch v := cost.(type) {
+	case time.Duration:
+		return float64(v) / float64(time.Millisecond), true
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case string:
+		ms, err := strconv.ParseFloat(strings.TrimSuffix(v, "ms"), 64)
+		return ms, err == nil
+	}
+	return 0, false
+}
+
+// limiter 令牌桶，每秒补充rate个令牌，最多burst个
+type limiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mu     sync.Mutex
+}
+
+func newLimiter(conf LogConfig) *limiter {
+	if conf.RateLimit <= 0 {
+		return nil
+	}
+	burst := conf.RateBurst
+	if burst <= 0 {
+		burst = conf.RateLimit
+	}
+	return &limiter{
+		rate:   float64(conf.RateLimit),
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (lim *limiter) allow() bool {
+	lim.mu.Lock()
+	defer lim.mu.Unlock()
+	now := time.Now()
+	lim.tokens += now.Sub(lim.last).Seconds() * lim.rate
+	if lim.tokens > lim.burst {
+		lim.tokens = lim.burst
+	}
+	lim.last = now
+	if lim.tokens < 1 {
+		return false
+	}
+	lim.tokens--
+	return true
+}
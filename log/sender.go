@@ -0,0 +1,130 @@
+package log
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+const MAX_RECONNECT_MS int = 30000
+
+// remote 远程Hook的连接参数，发送时读取，构造后修改同样生效
+type remote interface {
+	dialConfig() (network string, addr string, connTimeout time.Duration, writeTimeout time.Duration, reconnect time.Duration)
+}
+
+// sender 远程Hook共用的发送：日志先进入本地有界队列，后台goroutine发送，Fire不会因为网络阻塞
+// 连接失败时重连间隔从ReconnectMs开始翻倍，最多30s，连接成功后恢复，期间日志留在队列中，队列满时丢弃最旧的
+type sender struct {
+	remote remote
+	queue  *AsyncWriter
+	conn   net.Conn
+	stop   chan struct{}
+	once   sync.Once
+}
+
+/**
+* size为本地队列行数，<=0时默认4096
+ */
+func newSender(r remote, size int) *sender {
+	s := &sender{
+		remote: r,
+		stop:   make(chan struct{}),
+	}
+	s.queue = NewAsyncWriter(senderWriter{s}, size, ASYNC_DROP_OLDEST)
+	return s
+}
+
+func (s *sender) write(p []byte) error {
+	_, err := s.queue.Write(p)
+	return err
+}
+
+/**
+* 等待队列发送完，远程不可用时最多等待timeout
+ */
+func (s *sender) flush(timeout time.Duration) error {
+	if !s.queue.FlushTimeout(timeout) {
+		return ErrFlushTimeout
+	}
+	return nil
+}
+
+/**
+* 发送队列中剩余的日志，连接不上时放弃，可重复调用
+ */
+func (s *sender) close() error {
+	s.once.Do(func() {
+		close(s.stop)
+	})
+	s.queue.Close()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return nil
+}
+
+/**
+* 只在队列的后台goroutine中调用，发送失败时重连后重发，Close后放弃
+ */
+func (s *sender) send(p []byte) {
+	backoff := time.Duration(0)
+	for {
+		network, addr, connTimeout, writeTimeout, reconnect := s.remote.dialConfig()
+		if s.conn == nil {
+			if s.stopped() {
+				return
+			}
+			conn, err := net.DialTimeout(network, addr, connTimeout)
+			if err != nil {
+				if backoff == 0 {
+					backoff = reconnect
+				} else if backoff *= 2; backoff > time.Duration(MAX_RECONNECT_MS)*time.Millisecond {
+					backoff = time.Duration(MAX_RECONNECT_MS) * time.Millisecond
+				}
+				if !s.wait(backoff) {
+					return
+				}
+				continue
+			}
+			s.conn = conn
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+		if _, err := s.conn.Write(p); err == nil {
+			return
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func (s *sender) stopped() bool {
+	select {
+	case <-s.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+/**
+* 等待重连，Close时返回false
+ */
+func (s *sender) wait(d time.Duration) bool {
+	select {
+	case <-s.stop:
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+type senderWriter struct {
+	s *sender
+}
+
+func (w senderWriter) Write(p []byte) (int, error) {
+	w.s.send(p)
+	return len(p), nil
+}
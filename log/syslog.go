@@ -0,0 +1,141 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SyslogHook 按RFC5424发送到syslog服务
+// udp一条日志一个包，tcp按RFC6587 octet-counting分帧
+// 与ForwardHook一样先进入本地队列由后台goroutine发送，服务不可用时不阻塞打日志，断线时按ReconnectMs重连
+// MSG为与Format json相同的一行json，trace_id同时放在structured data中
+type SyslogHook struct {
+	Network        string // udp/tcp
+	Addr           string
+	AppName        string
+	Hostname       string // 默认os.Hostname()
+	Facility       int    // 默认16(local0)
+	Level          Level  // 只发送该级别及以上，默认ALL
+	ConnTimeoutMs  int    // 默认1000
+	WriteTimeoutMs int    // 默认1000
+	ReconnectMs    int    // 首次重连间隔，之后翻倍，默认1000
+
+	sender *sender
+}
+
+func NewSyslogHook(network string, addr string, appName string) *SyslogHook {
+	hostname, _ := os.Hostname()
+	h := &SyslogHook{
+		Network:        network,
+		Addr:           addr,
+		AppName:        appName,
+		Hostname:       hostname,
+		Facility:       16,
+		Level:          ALL,
+		ConnTimeoutMs:  1000,
+		WriteTimeoutMs: 1000,
+		ReconnectMs:    1000,
+	}
+	h.sender = newSender(h, 0)
+	return h
+}
+
+func (h *SyslogHook) Fire(entry *Entry) error {
+	if entry.Level > h.Level {
+		return nil
+	}
+	msg := h.format(entry)
+	if h.Network != "udp" {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+	return h.sender.write([]byte(msg))
+}
+
+/**
+* 等待队列发送完，最多等待timeout，超时返回ErrFlushTimeout，logger Sync时调用
+ */
+func (h *SyslogHook) Flush(timeout time.Duration) error {
+	return h.sender.flush(timeout)
+}
+
+func (h *SyslogHook) Dropped() int64 {
+	return h.sender.queue.Dropped()
+}
+
+/**
+* 发送队列中剩余的日志，连接不上时放弃，可重复调用
+ */
+func (h *SyslogHook) Close() error {
+	return h.sender.close()
+}
+
+func (h *SyslogHook) dialConfig() (string, string, time.Duration, time.Duration, time.Duration) {
+	return h.Network, h.Addr, time.Duration(h.ConnTimeoutMs) * time.Millisecond,
+		time.Duration(h.WriteTimeoutMs) * time.Millisecond, time.Duration(h.ReconnectMs) * time.Millisecond
+}
+
+/**
+* <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+* MSGID取action字段
+ */
+func (h *SyslogHook) format(entry *Entry) string {
+	sd := "-"
+	if entry.TraceId != "" {
+		sd = fmt.Sprintf(`[golib@32473 trace_id="%s"]`, escapeSdParam(entry.TraceId))
+	}
+	msgId := "-"
+	if action, ok := entry.Fields["action"].(string); ok {
+		msgId = syslogHeaderField(action, 32)
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		h.Facility*8+syslogSeverity(entry.Level),
+		entry.Time.Format(FORMAT_TIME_JSON),
+		syslogHeaderField(h.Hostname, 255),
+		syslogHeaderField(h.AppName, 48),
+		os.Getpid(),
+		msgId,
+		sd,
+		entry.Json(),
+	)
+}
+
+func syslogSeverity(level Level) int {
+	switch level {
+	case FATAL:
+		return 2 // critical
+	case ERROR:
+		return 3
+	case WARNING:
+		return 4
+	case INFO:
+		return 6
+	}
+	return 7 // debug
+}
+
+/**
+* header字段为不含空格的可打印ascii，为空时用-
+ */
+func syslogHeaderField(s string, maxLen int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= ' ' || r > '~' {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > maxLen {
+		s = s[:maxLen]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func escapeSdParam(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(s)
+}
@@ -1,16 +1,16 @@
 package log
 
 import (
-	"bytes"
-	"fmt"
 	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 const FORMAT_TIME_DAY string = "20060102"
 const FORMAT_TIME_HOUR string = "2006010215"
+const FORMAT_TIME_TEXT string = "2006/01/02 15:04:05.000000"
 
 func getDayTime(t time.Time) string {
 	return t.Format(FORMAT_TIME_DAY)
@@ -20,20 +20,19 @@ func getHourTime(t time.Time) string {
 	return t.Format(FORMAT_TIME_HOUR)
 }
 
-func getCurrentTime(conf LogConfig) string {
+/**
+* t所属的切割时间段，不按时间切割时为空
+ */
+func getRotateTime(conf LogConfig, t time.Time) string {
 	var rotateTime string
 	if conf.RotateByDaily == true {
-		rotateTime = getDayTime(time.Now())
+		rotateTime = getDayTime(t)
 	} else if conf.RotateByHour == true {
-		rotateTime = getHourTime(time.Now())
+		rotateTime = getHourTime(t)
 	}
 	return rotateTime
 }
 
-func getPrefixByLevel(level Level) string {
-	return fmt.Sprintf("【%s】", levelToString(level))
-}
-
 func levelToString(level Level) string {
 	switch level {
 	case FATAL:
@@ -66,36 +65,40 @@ func stringToLevel(level string) Level {
 	return ALL
 }
 
-func getTimeInt(now time.Time) uint64 {
-	return uint64(now.Year())*1000000 + uint64(now.Month())*10000 + uint64(now.Day())*100 + uint64(now.Hour())
-}
-
-func shouldDel(fileName string, keepTime time.Time) bool {
-
-	// project.log.2019071016 -> 2019071016
-	strs := strings.Split(fileName, ".")
-	tint, err := strconv.Atoi(strs[len(strs)-1])
-	if err != nil {
-		return false
-	}
-
-	if uint64(tint) < getTimeInt(keepTime) {
-		return true
+// 调用位置按pc缓存，同一调用点只格式化一次
+var callerCache = struct {
+	sync.RWMutex
+	m map[uintptr]string
+}{m: make(map[uintptr]string)}
+
+/**
+* 调用位置 file:line::function，skip同runtime.Caller
+ */
+func getCaller(skip int) string {
+	var pcs [1]uintptr
+	runtime.Callers(skip+1, pcs[:])
+	pc := pcs[0]
+
+	callerCache.RLock()
+	caller, ok := callerCache.m[pc]
+	callerCache.RUnlock()
+	if ok {
+		return caller
 	}
 
-	return false
-}
-
-func getbuf() *bytes.Buffer {
-	return &bytes.Buffer{}
+	// 同runtime.Caller，CallersFrames处理内联
+	frame, _ := runtime.CallersFrames([]uintptr{pc}).Next()
+	caller = shortFile(frame.File) + ":" + strconv.Itoa(frame.Line) + "::" + frame.Function
+	callerCache.Lock()
+	callerCache.m[pc] = caller
+	callerCache.Unlock()
+	return caller
 }
 
-func header() string {
-
-	pc, file, line, _ := runtime.Caller(3)
-	function := runtime.FuncForPC(pc)
-
-	// 缩短文件名，最多显示3级
+/**
+* 缩短文件名，最多显示3级
+ */
+func shortFile(file string) string {
 	dirs := strings.Split(file, "/")
 	n := len(dirs)
 	if n > 3 {
@@ -105,31 +108,35 @@ func header() string {
 	for i := n; i > 0; i-- {
 		fileName += dirs[len(dirs)-i] + "/"
 	}
-	fileName = strings.TrimSuffix(fileName, "/")
-
-	return "[" + fileName + ":" + strconv.Itoa(line) + "::" + function.Name() + "]"
+	return strings.TrimSuffix(fileName, "/")
 }
 
-func contentToBuffer(header string, body string) *bytes.Buffer {
-
-	buf := &bytes.Buffer{}
+/**
+* 调用栈，每一帧格式同getCaller，从skip对应的帧开始，以 <- 连接保证一行
+ */
+func getStack(skip int) string {
+	return formatFrames(callerFrames(skip + 1))
+}
 
-	fmt.Fprintf(buf, header)
-	fmt.Fprintf(buf, " ")
-	fmt.Fprintf(buf, body)
-	if buf.Bytes()[buf.Len()-1] != '\n' {
-		buf.WriteByte('\n')
+func callerFrames(skip int) []runtime.Frame {
+	pcs := make([]uintptr, 64)
+	n := runtime.Callers(skip+1, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	var stack []runtime.Frame
+	for {
+		frame, more := frames.Next()
+		stack = append(stack, frame)
+		if !more {
+			break
+		}
 	}
-
-	return buf
+	return stack
 }
 
-func mapToStr(m map[string]interface{}) string {
-	var str string
-	for k, v := range m {
-		str = str + fmt.Sprintf("%v=%v", k, v)
-		str = str + "||"
+func formatFrames(frames []runtime.Frame) string {
+	stack := make([]string, 0, len(frames))
+	for _, frame := range frames {
+		stack = append(stack, shortFile(frame.File)+":"+strconv.Itoa(frame.Line)+"::"+frame.Function)
 	}
-
-	return strings.TrimSuffix(str, "||")
+	return strings.Join(stack, " <- ")
 }
@@ -0,0 +1,307 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const FORMAT_TIME_SECOND string = "20060102150405"
+
+// RotateWriter 按小时/天以及文件大小切割的日志文件，并发安全
+// 切割在Write中完成：关闭旧文件，在Dir中重命名为 FileName.(rotateTime)，再打开新文件
+// 后台goroutine负责压缩切割文件以及按KeepDays/MaxBackups/MaxTotalSizeMB清理，Close时停止
+type RotateWriter struct {
+	conf       LogConfig
+	fd         *os.File
+	size       int64  // 当前文件大小
+	rotateTime string // 当前文件所属时间段 .log -> .log.(rotateTime)
+	stop       chan struct{}
+	done       chan struct{} // 后台goroutine退出
+	rotated    chan struct{} // 切割后通知后台立即压缩/清理
+	mu         sync.Mutex
+}
+
+func NewRotateWriter(conf LogConfig) (*RotateWriter, error) {
+	w := &RotateWriter{conf: conf}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	w.rotated = make(chan struct{}, 1)
+	go w.daemon(w.stop)
+
+	return w, nil
+}
+
+func (w *RotateWriter) Write(p []byte) (n int, err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fd == nil {
+		return 0, os.ErrClosed
+	}
+
+	if w.shouldRotate(int64(len(p))) {
+		// 切割失败时继续写原文件
+		if err = w.rotate(); err != nil && w.fd == nil {
+			return 0, err
+		}
+	}
+	n, err = w.fd.Write(p)
+	w.size += int64(n)
+
+	return n, err
+}
+
+/**
+* 立即切割
+ */
+func (w *RotateWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fd == nil {
+		return os.ErrClosed
+	}
+	return w.rotate()
+}
+
+/**
+* 刷盘
+ */
+func (w *RotateWriter) Sync() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.fd == nil {
+		return os.ErrClosed
+	}
+	return w.fd.Sync()
+}
+
+/**
+* 停止后台清理并关闭文件，等待进行中的压缩完成，可重复调用
+ */
+func (w *RotateWriter) Close() error {
+	w.mu.Lock()
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+	var err error
+	if w.fd != nil {
+		err = w.fd.Close()
+		w.fd = nil
+	}
+	w.mu.Unlock()
+
+	<-w.done
+	return err
+}
+
+func (w *RotateWriter) filePath() string {
+	return path.Join(w.conf.Dir, w.conf.FileName)
+}
+
+/**
+* 打开日志文件，已有文件按最后修改时间确定所属时间段，避免重启后跨时间段的内容被切到新时间段
+ */
+func (w *RotateWriter) open() error {
+	fd, err := os.OpenFile(w.filePath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return err
+	}
+
+	w.fd = fd
+	w.size = info.Size()
+	w.rotateTime = getRotateTime(w.conf, time.Now())
+	if w.size > 0 {
+		w.rotateTime = getRotateTime(w.conf, info.ModTime())
+	}
+	return nil
+}
+
+func (w *RotateWriter) shouldRotate(n int64) bool {
+	if w.conf.MaxSizeMB > 0 && w.size > 0 && w.size+n > int64(w.conf.MaxSizeMB)*1024*1024 {
+		return true
+	}
+	return w.rotateTime != getRotateTime(w.conf, time.Now())
+}
+
+/**
+* 关闭旧文件，重命名后打开新文件
+* 时间切割后缀为所属时间段，同一时间段内按大小切割时后缀为当前时间到秒，重名时追加序号
+ */
+func (w *RotateWriter) rotate() error {
+	w.fd.Close()
+	w.fd = nil
+
+	suffix := w.rotateTime
+	if suffix == getRotateTime(w.conf, time.Now()) {
+		suffix = time.Now().Format(FORMAT_TIME_SECOND)
+	}
+	target := w.filePath() + "." + suffix
+	for i := 1; fileExists(target); i++ {
+		target = fmt.Sprintf("%s.%s.%d", w.filePath(), suffix, i)
+	}
+	if err := os.Rename(w.filePath(), target); err != nil {
+		if e := w.open(); e != nil {
+			return e
+		}
+		// 避免每次写都重试
+		w.rotateTime = getRotateTime(w.conf, time.Now())
+		return err
+	}
+
+	select {
+	case w.rotated <- struct{}{}:
+	default:
+	}
+	return w.open()
+}
+
+func (w *RotateWriter) daemon(stop chan struct{}) {
+	defer close(w.done)
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		w.clean()
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case <-w.rotated:
+		}
+	}
+}
+
+/**
+* 删除超过KeepDays、超出MaxBackups个数的切割文件，开启Compress时压缩剩余文件
+* 压缩后切割文件总大小仍超过MaxTotalSizeMB时从最旧的开始删除
+ */
+func (w *RotateWriter) clean() {
+	backups := w.backups()
+	var minKeepTime time.Time
+	if w.conf.KeepDays > 0 {
+		minKeepTime = time.Now().AddDate(0, 0, -w.conf.KeepDays)
+	}
+	for i, file := range backups {
+		if file.ModTime().Before(minKeepTime) || (w.conf.MaxBackups > 0 && i >= w.conf.MaxBackups) {
+			os.Remove(w.backupPath(file.Name()))
+		} else if w.conf.Compress && !strings.HasSuffix(file.Name(), ".gz") {
+			compressFile(w.backupPath(file.Name()))
+		}
+	}
+
+	if w.conf.MaxTotalSizeMB <= 0 {
+		return
+	}
+	var total int64
+	for _, file := range w.backups() {
+		total += file.Size()
+		if total > int64(w.conf.MaxTotalSizeMB)*1024*1024 {
+			os.Remove(w.backupPath(file.Name()))
+		}
+	}
+}
+
+/**
+* 切割文件，按修改时间从新到旧排序
+* 压缩中断留下的.gz在原文件仍存在时忽略，下次重新压缩
+ */
+func (w *RotateWriter) backups() []os.FileInfo {
+	files, err := ioutil.ReadDir(w.backupPath(""))
+	if err != nil {
+		return nil
+	}
+	names := make(map[string]bool, len(files))
+	for _, file := range files {
+		names[file.Name()] = true
+	}
+	var backups []os.FileInfo
+	for _, file := range files {
+		name := file.Name()
+		if !isRotatedFile(w.conf.FileName, name) {
+			continue
+		}
+		if strings.HasSuffix(name, ".gz") && names[strings.TrimSuffix(name, ".gz")] {
+			continue
+		}
+		backups = append(backups, file)
+	}
+	sort.SliceStable(backups, func(i, j int) bool {
+		return backups[i].ModTime().After(backups[j].ModTime())
+	})
+	return backups
+}
+
+func (w *RotateWriter) backupPath(name string) string {
+	dir := w.conf.Dir
+	if dir == "" {
+		dir = "."
+	}
+	return path.Join(dir, name)
+}
+
+/**
+* 压缩为name.gz后删除原文件，保留原文件修改时间以便按KeepDays清理
+ */
+func compressFile(name string) error {
+	src, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return err
+	}
+
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(dst)
+	_, err = io.Copy(gz, src)
+	if e := gz.Close(); err == nil {
+		err = e
+	}
+	if e := dst.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return err
+	}
+
+	os.Chtimes(name+".gz", info.ModTime(), info.ModTime())
+	return os.Remove(name)
+}
+
+/**
+* project.log.2019071016 / project.log.20190710160512.1 / project.log.2019071016.gz 是 project.log 的切割文件
+ */
+func isRotatedFile(fileName string, name string) bool {
+	if !strings.HasPrefix(name, fileName+".") {
+		return false
+	}
+	suffix := strings.TrimPrefix(name, fileName+".")
+	return suffix != "" && suffix[0] >= '0' && suffix[0] <= '9'
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -0,0 +1,439 @@
+package pool
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var ErrNoAvailableNode = fmt.Errorf("no available node")
+
+/**
+* 多节点选择策略
+ */
+type Balance int
+
+const (
+	BalanceWeightedRandom Balance = iota // 按权重随机
+	BalanceRoundRobin                    // 平滑加权轮询
+	BalanceLeastConn                     // 使用中连接数/权重最小
+)
+
+// Endpoint 节点地址以及权重，权重<=0按1处理
+type Endpoint struct {
+	Addr   string
+	Weight int
+}
+
+// NodeStatus 节点健康状态快照
+type NodeStatus struct {
+	Addr         string
+	Weight       int
+	Failures     int       // 连续失败次数
+	Ejected      bool      // 是否被摘除
+	EjectedUntil time.Time // 摘除到期时间
+	Stats        Stats
+}
+
+/**
+* 节点：一个地址一个连接池
+ */
+type node[T Conn] struct {
+	addr         string
+	weight       int
+	pool         *Pool[T]
+	failures     int       // 连续失败次数
+	ejections    int       // 连续摘除次数，用于退避
+	ejectedUntil time.Time // 摘除到期时间，到期后半开，成功则恢复
+	current      int       // 平滑加权轮询的当前权重
+	inUse        int       // 通过MultiPool借出未归还的连接数，m.mu保护，选择时不需要节点连接池的锁
+}
+
+// MultiPool 多地址连接池，每个地址一个Pool，按节点健康状况以及负载策略选择
+// 连续失败MaxFailures次的节点被摘除，摘除时间指数退避，到期后探活或由请求试探恢复
+type MultiPool[T Conn] struct {
+	Balance        Balance
+	MaxFailures    int                     // 连续失败多少次摘除，<=0时默认3
+	EjectMs        int                     // 首次摘除时长，单位ms，<=0时默认1000
+	MaxEjectMs     int                     // 摘除时长上限，单位ms，<=0时默认30000
+	Probe          func(addr string) error // 探活，nil时从节点连接池取一个连接再归还
+	ProbeTimeoutMs int                     // 从节点连接池取连接探活的超时，单位ms，<=0时默认1000，节点连接池满时不阻塞探活
+
+	nodes     []*node[T]
+	owner     map[Conn]*node[T] // 借出的连接属于哪个节点
+	rand      *rand.Rand
+	stopProbe chan struct{}
+	mu        sync.Mutex
+}
+
+func NewMultiPool[T Conn](endpoints []Endpoint, newPool func(addr string) *Pool[T]) *MultiPool[T] {
+	m := &MultiPool[T]{
+		owner: make(map[Conn]*node[T]),
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	for _, ep := range endpoints {
+		weight := ep.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		m.nodes = append(m.nodes, &node[T]{
+			addr:   ep.Addr,
+			weight: weight,
+			pool:   newPool(ep.Addr),
+		})
+	}
+
+	return m
+}
+
+func (m *MultiPool[T]) Get() (conn T, err error) {
+	return m.GetContext(context.Background())
+}
+
+/**
+* 选择节点获取连接，节点创建连接失败时换下一个节点
+ */
+func (m *MultiPool[T]) GetContext(ctx context.Context) (conn T, err error) {
+	tried := make(map[*node[T]]bool, len(m.nodes))
+	for range m.nodes {
+		m.mu.Lock()
+		n := m.pick(tried)
+		m.mu.Unlock()
+		if n == nil {
+			break
+		}
+		tried[n] = true
+
+		conn, err = n.pool.GetContext(ctx)
+		if err == nil {
+			m.mu.Lock()
+			m.owner[conn] = n
+			n.inUse++
+			m.succeed(n)
+			m.mu.Unlock()
+			return conn, nil
+		}
+		if !isNodeError(ctx, err) {
+			return conn, err
+		}
+		m.mu.Lock()
+		m.fail(n)
+		m.mu.Unlock()
+	}
+	if err == nil {
+		err = ErrNoAvailableNode
+	}
+
+	return conn, err
+}
+
+func (m *MultiPool[T]) Put(conn T) {
+	m.PutWithError(conn, nil)
+}
+
+/**
+* 归还连接，err不为nil时关闭连接并记一次节点失败
+ */
+func (m *MultiPool[T]) PutWithError(conn T, err error) {
+	m.mu.Lock()
+	n, ok := m.owner[conn]
+	delete(m.owner, conn)
+	if ok {
+		n.inUse--
+		if err != nil {
+			m.fail(n)
+		}
+	}
+	m.mu.Unlock()
+	if ok {
+		n.pool.PutWithError(conn, err)
+	}
+}
+
+/**
+* 启动后台探活，定期检查摘除到期的节点，Close/Destory时停止
+* interval<=0时默认1s
+ */
+func (m *MultiPool[T]) StartProbe(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopProbe != nil {
+		return
+	}
+	m.stopProbe = make(chan struct{})
+	go m.probeLoop(interval, m.stopProbe)
+}
+
+func (m *MultiPool[T]) probeLoop(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			m.probe()
+		}
+	}
+}
+
+/**
+* 探测摘除到期的节点，成功恢复，失败继续摘除
+ */
+func (m *MultiPool[T]) probe() {
+	now := time.Now()
+	m.mu.Lock()
+	var nodes []*node[T]
+	for _, n := range m.nodes {
+		if !n.ejectedUntil.IsZero() && !now.Before(n.ejectedUntil) {
+			nodes = append(nodes, n)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, n := range nodes {
+		err := m.probeNode(n)
+		m.mu.Lock()
+		if err == nil {
+			m.succeed(n)
+		} else {
+			m.eject(n)
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (m *MultiPool[T]) probeNode(n *node[T]) error {
+	if m.Probe != nil {
+		return m.Probe(n.addr)
+	}
+	timeoutMs := m.ProbeTimeoutMs
+	if timeoutMs <= 0 {
+		timeoutMs = 1000
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeoutMs)*time.Millisecond)
+	defer cancel()
+	conn, err := n.pool.GetContext(ctx)
+	if err != nil {
+		return err
+	}
+	n.pool.Put(conn)
+	return nil
+}
+
+/**
+* 各节点健康状态
+* 节点连接池的统计在释放m.mu后读取，节点创建连接慢时不影响其它节点的选择与归还
+ */
+func (m *MultiPool[T]) Nodes() []NodeStatus {
+	m.mu.Lock()
+	now := time.Now()
+	status := make([]NodeStatus, 0, len(m.nodes))
+	for _, n := range m.nodes {
+		status = append(status, NodeStatus{
+			Addr:         n.addr,
+			Weight:       n.weight,
+			Failures:     n.failures,
+			Ejected:      now.Before(n.ejectedUntil),
+			EjectedUntil: n.ejectedUntil,
+		})
+	}
+	m.mu.Unlock()
+
+	for i, n := range m.nodes {
+		status[i].Stats = n.pool.Stats()
+	}
+	return status
+}
+
+/**
+* 所有节点的统计之和
+ */
+func (m *MultiPool[T]) Stats() Stats {
+	var total Stats
+	for _, n := range m.nodes {
+		s := n.pool.Stats()
+		total.Idle += s.Idle
+		total.InUse += s.InUse
+		total.Dials += s.Dials
+		total.DialErrors += s.DialErrors
+		total.WaitCount += s.WaitCount
+		total.WaitDuration += s.WaitDuration
+		total.BorrowTestFailures += s.BorrowTestFailures
+		total.IdleTimeoutClosed += s.IdleTimeoutClosed
+		total.MaxIdleClosed += s.MaxIdleClosed
+		total.MaxLifetimeClosed += s.MaxLifetimeClosed
+		total.BrokenClosed += s.BrokenClosed
+	}
+	return total
+}
+
+/**
+* 优雅关闭所有节点，返回最后一个错误
+ */
+func (m *MultiPool[T]) Close(ctx context.Context) (err error) {
+	m.stop()
+	for _, n := range m.nodes {
+		if e := n.pool.Close(ctx); e != nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (m *MultiPool[T]) Destory() {
+	m.stop()
+	for _, n := range m.nodes {
+		n.pool.Destory()
+	}
+}
+
+func (m *MultiPool[T]) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopProbe != nil {
+		close(m.stopProbe)
+		m.stopProbe = nil
+	}
+}
+
+/**
+* 按策略从未尝试过的健康节点中选择，全部节点都被摘除时退化为在所有节点中选择
+ */
+func (m *MultiPool[T]) pick(tried map[*node[T]]bool) *node[T] {
+	now := time.Now()
+	var healthy, rest []*node[T]
+	allEjected := true
+	for _, n := range m.nodes {
+		ejected := now.Before(n.ejectedUntil)
+		if !ejected {
+			allEjected = false
+		}
+		if tried[n] {
+			continue
+		}
+		if ejected {
+			rest = append(rest, n)
+		} else {
+			healthy = append(healthy, n)
+		}
+	}
+	candidates := healthy
+	if allEjected {
+		candidates = rest
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	switch m.Balance {
+	case BalanceRoundRobin:
+		return m.pickRoundRobin(candidates)
+	case BalanceLeastConn:
+		return m.pickLeastConn(candidates)
+	}
+	return m.pickRandom(candidates)
+}
+
+func (m *MultiPool[T]) pickRandom(candidates []*node[T]) *node[T] {
+	total := 0
+	for _, n := range candidates {
+		total += n.weight
+	}
+	r := m.rand.Intn(total)
+	for _, n := range candidates {
+		if r < n.weight {
+			return n
+		}
+		r -= n.weight
+	}
+	return candidates[len(candidates)-1]
+}
+
+/**
+* 平滑加权轮询，参考nginx
+ */
+func (m *MultiPool[T]) pickRoundRobin(candidates []*node[T]) *node[T] {
+	var best *node[T]
+	total := 0
+	for _, n := range candidates {
+		n.current += n.weight
+		total += n.weight
+		if best == nil || n.current > best.current {
+			best = n
+		}
+	}
+	best.current -= total
+	return best
+}
+
+func (m *MultiPool[T]) pickLeastConn(candidates []*node[T]) *node[T] {
+	var best *node[T]
+	var bestLoad float64
+	for _, n := range candidates {
+		load := float64(n.inUse) / float64(n.weight)
+		if best == nil || load < bestLoad {
+			best, bestLoad = n, load
+		}
+	}
+	return best
+}
+
+func (m *MultiPool[T]) succeed(n *node[T]) {
+	n.failures = 0
+	n.ejections = 0
+	n.ejectedUntil = time.Time{}
+}
+
+func (m *MultiPool[T]) fail(n *node[T]) {
+	n.failures++
+	maxFailures := m.MaxFailures
+	if maxFailures <= 0 {
+		maxFailures = 3
+	}
+	if n.failures >= maxFailures {
+		m.eject(n)
+	}
+}
+
+/**
+* 摘除节点，摘除时长按连续摘除次数指数退避
+ */
+func (m *MultiPool[T]) eject(n *node[T]) {
+	ejectMs, maxEjectMs := m.EjectMs, m.MaxEjectMs
+	if ejectMs <= 0 {
+		ejectMs = 1000
+	}
+	if maxEjectMs <= 0 {
+		maxEjectMs = 30000
+	}
+	backoff := time.Duration(ejectMs) * time.Millisecond
+	max := time.Duration(maxEjectMs) * time.Millisecond
+	for i := 0; i < n.ejections && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	n.ejections++
+	n.ejectedUntil = time.Now().Add(backoff)
+}
+
+/**
+* 是否是节点本身的问题（创建连接失败、健康检查失败），而不是调用方取消或连接池限制
+ */
+func isNodeError(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	switch err {
+	case ErrMaxConn, ErrWaitTimeout, ErrPoolClosed, context.Canceled, context.DeadlineExceeded:
+		return false
+	}
+	return true
+}
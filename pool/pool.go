@@ -2,26 +2,66 @@ package pool
 
 import (
 	"container/list"
+	"context"
 	"fmt"
 	"sync"
 	"time"
 )
 
-var ErrMaxConn = fmt.Errorf("maximum connections reached")
+var (
+	ErrMaxConn     = fmt.Errorf("maximum connections reached")
+	ErrWaitTimeout = fmt.Errorf("wait for connection timeout")
+	ErrPoolClosed  = fmt.Errorf("connection pool closed")
+)
 
 type Conn interface {
 	Close() error
 }
 
+/**
+* 空闲连接的复用策略
+ */
+type IdleStrategy int
+
+const (
+	IdleLIFO IdleStrategy = iota // 优先复用最近归还的连接，保持少量连接常热
+	IdleFIFO                     // 优先复用最早归还的连接，连接轮流使用，负载分散到各个server
+)
+
+/**
+* 打开连接的元信息
+ */
+type connInfo struct {
+	created  time.Time // 创建时间
+	unusable bool      // 被MarkUnusable标记，释放时关闭
+}
+
 /**
 * idlelist 成员：池子中的连接
  */
 type idle struct {
-	p ConnPool
 	c Conn
 	t time.Time
 }
 
+// Options 连接池的调优参数，ConnPool与Pool[T]共用
+type Options struct {
+	MaxActive    int // 同一时刻最多使用连接数 max active
+	MaxIdle      int // 池子最大保留连接 max idle
+	MinIdle      int // 池子最少保留连接，Warm预热以及后台回收时补齐，不超过MaxIdle
+	IdleTimeoutS int // 池子中的连接过期时间，单位s
+	MaxLifetimeS int // 连接从创建起的最大存活时间，单位s，0表示不限制
+
+	// If Wait is true and the pool is at the MaxActive limit, then Get() Waits
+	// for a connection to be returned to the pool before returning.
+	Wait          bool
+	WaitTimeoutMs int // Wait为true时最长等待时间，单位ms，0表示不限制
+
+	IdleStrategy IdleStrategy // 默认IdleLIFO
+
+	OnWarmError func(error) // 预热/补齐空闲连接失败时回调，失败不影响使用
+}
+
 // ConnPool manages the life cycle of connections
 type ConnPool struct {
 	sync.RWMutex
@@ -29,20 +69,20 @@ type ConnPool struct {
 	// Dial is used to create a new connection when necessary.
 	Dial         func() (Conn, error)
 	TestOnBorrow func(Conn) error // 测试连接健康，比如检查角色是否master，ping是否正常
+	OnClose      func(Conn)       // 池子关闭连接前回调
 
-	MaxActive    int // 同一时刻最多使用连接数 max active
-	MaxIdle      int // 池子最大保留连接 max idle
-	IdleTimeoutS int // 池子中的连接过期时间，单位s
-
-	// If Wait is true and the pool is at the MaxActive limit, then Get() Waits
-	// for a connection to be returned to the pool before returning.
-	Wait bool
+	Options
 
 	active   int // 当前正在使用的连接数 active = idle + using
 	idlelist list.List
+	stats    Stats              // 累计统计，Idle/InUse在Stats()中实时计算
+	conns    map[Conn]*connInfo // 所有打开的连接，Conn需可比较（指针等）
+	stopReap chan struct{}      // 关闭以停止后台回收
+	waiters  list.List          // 等待连接的Get，先进先出，成员为chan Conn
+	closed   bool               // 已关闭，拒绝新的Get，归还的连接直接关闭
+	drained  chan struct{}      // 关闭后所有连接都已释放时close
 	// mu protects fields defined below.
-	mu   sync.Mutex
-	cond *sync.Cond
+	mu sync.Mutex
 }
 
 func New(
@@ -54,15 +94,15 @@ func New(
 	wait bool,
 ) *ConnPool {
 	pool := &ConnPool{
-		MaxIdle:      maxIdle,
-		MaxActive:    maxActive,
-		IdleTimeoutS: idleTimeoutS,
 		Dial:         dial,
 		TestOnBorrow: TestOnBorrow,
-		Wait:         wait,
-	}
-	if pool.Wait {
-		pool.cond = sync.NewCond(&pool.mu)
+		Options: Options{
+			MaxIdle:      maxIdle,
+			MaxActive:    maxActive,
+			IdleTimeoutS: idleTimeoutS,
+			Wait:         wait,
+		},
+		conns: make(map[Conn]*connInfo),
 	}
 
 	return pool
@@ -72,52 +112,145 @@ func New(
 * 设计理念：所有的对外接口，上层加锁，下层私有函数不加锁，防止同一个锁在不同层中使用导致重入，因为go没有可重入锁
  */
 func (this *ConnPool) Get() (conn Conn, err error) {
-	this.mu.Lock()
-	defer this.mu.Unlock()
-	if this.IdleTimeoutS > 0 {
-		this.closeExipredIdle()
+	return this.GetContext(context.Background())
+}
+
+/**
+* 获取连接，等待时受ctx的取消/超时以及WaitTimeoutMs控制
+* Dial以及TestOnBorrow在锁外执行，慢的server不阻塞其它Get/Release，返回前ctx已结束时归还连接并返回ctx.Err()
+ */
+func (this *ConnPool) GetContext(ctx context.Context) (conn Conn, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	waitCtx := ctx
+	if this.Wait && this.WaitTimeoutMs > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, time.Duration(this.WaitTimeoutMs)*time.Millisecond)
+		defer cancel()
 	}
 
+	// reserved为true表示已经占到active名额，直接创建连接
+	reserved := false
 	for {
-		// 从连接池中取
-		for {
-			conn = this.getIdleConn()
-			// idle empty
-			if conn == nil {
-				break
-			}
-			if this.TestOnBorrow != nil {
-				err = this.TestOnBorrow(conn)
-			}
-			if err == nil {
-				return conn, nil
+		fromIdle := false
+		if !reserved {
+			if conn, fromIdle, err = this.reserve(ctx, waitCtx); err != nil {
+				return nil, err
 			}
+			reserved = conn == nil
 		}
 
-		// 创建新连接
-		if this.MaxActive == 0 || !this.overMaxActive() {
+		if reserved {
 			conn, err = this.Dial()
-			if err == nil {
-				this.increActive(1)
-				if this.TestOnBorrow != nil {
-					err = this.TestOnBorrow(conn)
-				}
+			this.mu.Lock()
+			this.dialed(conn, err)
+			if err != nil {
+				this.releaseSlot()
+				this.mu.Unlock()
+				return nil, err
 			}
-			return conn, err
+			this.mu.Unlock()
 		}
 
-		// 连接数超过active上限返回错误
-		if !this.Wait {
-			conn = nil
-			err = ErrMaxConn
-			return conn, err
+		if err = this.testOnBorrow(conn); err != nil {
+			this.mu.Lock()
+			if reserved {
+				// 新建的连接不健康，关闭并释放active
+				this.close(conn)
+				this.mu.Unlock()
+				return nil, err
+			}
+			if fromIdle {
+				// 空闲连接不健康，关闭后重新获取
+				this.close(conn)
+			} else {
+				// 交付的连接不健康，关闭后保留名额重新创建
+				this.closeConn(conn)
+				reserved = true
+			}
+			this.mu.Unlock()
+			continue
+		}
+
+		// 创建或检查连接期间ctx已结束
+		if err = ctx.Err(); err != nil {
+			this.mu.Lock()
+			this.put(conn)
+			this.mu.Unlock()
+			return nil, err
 		}
+		return conn, nil
+	}
+}
+
+/**
+* 取空闲连接或占一个active名额，conn为nil表示已占名额，由调用方创建连接
+* 连接数达到MaxActive时排队等待，释放者直接把连接（或active名额）交给队首，fromIdle表示连接来自池子
+ */
+func (this *ConnPool) reserve(ctx context.Context, waitCtx context.Context) (conn Conn, fromIdle bool, err error) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.closed {
+		return nil, false, ErrPoolClosed
+	}
+	this.closeExipredIdle()
 
-		// 等待其它连接释放
-		this.cond.Wait()
+	// 从连接池中取，有人排队时池子必然为空，不会插队
+	if conn = this.getIdleConn(); conn != nil {
+		return conn, true, nil
 	}
 
-	return conn, err
+	// 创建新连接，先占active名额
+	if this.MaxActive == 0 || !this.overMaxActive() {
+		this.increActive(1)
+		return nil, false, nil
+	}
+
+	// 连接数超过active上限返回错误
+	if !this.Wait {
+		return nil, false, ErrMaxConn
+	}
+
+	waitStart := time.Now()
+	this.stats.WaitCount++
+	ch := make(chan Conn, 1)
+	e := this.waiters.PushBack(ch)
+	this.mu.Unlock()
+	select {
+	case conn = <-ch:
+		this.mu.Lock()
+		this.stats.WaitDuration += time.Since(waitStart)
+		// 等待期间连接池被关闭
+		if this.closed {
+			if conn != nil {
+				this.close(conn)
+			} else {
+				this.releaseSlot()
+			}
+			return nil, false, ErrPoolClosed
+		}
+		return conn, false, nil
+	case <-waitCtx.Done():
+		this.mu.Lock()
+		this.stats.WaitDuration += time.Since(waitStart)
+		this.waiters.Remove(e)
+		// 出队前已经被交付，归还给下一个等待者
+		select {
+		case c := <-ch:
+			if c != nil {
+				this.put(c)
+			} else {
+				this.releaseSlot()
+			}
+		default:
+		}
+		if err = ctx.Err(); err == nil {
+			err = ErrWaitTimeout
+		}
+		return nil, false, err
+	}
 }
 
 /**
@@ -125,52 +258,304 @@ func (this *ConnPool) Get() (conn Conn, err error) {
 * 关掉连接 或 放入池中
  */
 func (this *ConnPool) Release(conn Conn) {
+	this.ReleaseWithError(conn, nil)
+}
+
+/**
+* 释放使用的连接，err不为nil（比如网络错误）或连接被MarkUnusable时直接关闭
+ */
+func (this *ConnPool) ReleaseWithError(conn Conn, err error) {
 	this.mu.Lock()
 	defer this.mu.Unlock()
-	if this.overMaxIdle() {
+	if this.closed {
+		// 强制关闭时已经关掉并清除了计数
+		if _, ok := this.conns[conn]; ok {
+			this.close(conn)
+		}
+		return
+	}
+	if err != nil || this.isUnusable(conn) {
+		this.stats.BrokenClosed++
+		this.close(conn)
+	} else if this.overLifetime(conn) {
+		this.stats.MaxLifetimeClosed++
 		this.close(conn)
 	} else {
-		this.idlelist.PushFront(idle{t: time.Now(), c: conn})
+		this.put(conn)
 	}
-	if this.cond != nil {
-		this.cond.Signal()
+}
+
+/**
+* 标记连接不可用，Release时关闭而不放回池子
+ */
+func (this *ConnPool) MarkUnusable(conn Conn) {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if info, ok := this.conns[conn]; ok {
+		info.unusable = true
 	}
 }
 
 /**
-* 销毁关闭所有连接
+* 销毁：拒绝新的Get，关闭空闲连接，使用中的连接归还时关闭，不等待
  */
 func (this *ConnPool) Destory() {
 	this.mu.Lock()
 	defer this.mu.Unlock()
-	this.decreActive(this.len())
+	this.shutdown()
+}
+
+/**
+* 优雅关闭：拒绝新的Get（返回ErrPoolClosed），等待使用中的连接归还后关闭
+* ctx结束时强制关闭所有连接并返回ctx.Err()
+ */
+func (this *ConnPool) Close(ctx context.Context) error {
+	this.mu.Lock()
+	this.shutdown()
+	drained := this.drained
+	this.mu.Unlock()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+	}
+
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	for conn := range this.conns {
+		this.closeConn(conn)
+		this.decreActive(1)
+	}
+	return ctx.Err()
+}
+
+/**
+* 标记关闭，停止后台回收，关闭空闲连接并唤醒所有等待者，可重复调用
+ */
+func (this *ConnPool) shutdown() {
+	if this.closed {
+		return
+	}
+	this.closed = true
+	this.drained = make(chan struct{})
+	if this.stopReap != nil {
+		close(this.stopReap)
+		this.stopReap = nil
+	}
 	idlelist := this.idlelist
 	this.idlelist.Init()
 	for e := idlelist.Front(); e != nil; e = e.Next() {
-		e.Value.(idle).c.Close()
+		this.close(e.Value.(idle).c)
 	}
-	if this.cond != nil {
-		this.cond.Broadcast()
+	// 交付名额唤醒，等待者发现已关闭后归还名额
+	for this.waiters.Len() > 0 {
+		this.increActive(1)
+		this.handoff(nil)
 	}
+	this.checkDrained()
 }
 
 func (this *ConnPool) Active() int {
+	this.mu.Lock()
+	defer this.mu.Unlock()
 	return this.active
 }
 
 /**
-* 尝试从池子中拿连接
+* 连接池统计快照
+ */
+func (this *ConnPool) Stats() Stats {
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	stats := this.stats
+	stats.Idle = this.len()
+	stats.InUse = this.active - stats.Idle
+	return stats
+}
+
+/**
+* 预热：创建连接直到空闲连接数达到MinIdle，返回最后一次失败的错误
+ */
+func (this *ConnPool) Warm() error {
+	return this.fillIdle()
+}
+
+/**
+* 启动后台回收，定期关闭空闲超时以及超过MaxLifetimeS的空闲连接，并补齐MinIdle，Destory时停止
+* interval<=0时默认1s
+ */
+func (this *ConnPool) StartReaper(interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	if this.stopReap != nil || this.closed {
+		return
+	}
+	this.stopReap = make(chan struct{})
+	go this.reap(interval, this.stopReap)
+}
+
+func (this *ConnPool) reap(interval time.Duration, stop chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			this.mu.Lock()
+			this.closeExipredIdle()
+			this.closeOverLifetimeIdle()
+			this.mu.Unlock()
+			this.fillIdle()
+		}
+	}
+}
+
+/**
+* 尝试从池子中拿连接，超过存活时间的直接关闭
+* 归还时放在队头，LIFO从队头取，FIFO从队尾取
  */
 func (this *ConnPool) getIdleConn() Conn {
-	if this.len() == 0 {
+	for this.len() > 0 {
+		e := this.idlelist.Front()
+		if this.IdleStrategy == IdleFIFO {
+			e = this.idlelist.Back()
+		}
+		ic := e.Value.(idle)
+		this.idlelist.Remove(e)
+		if !this.overLifetime(ic.c) {
+			return ic.c
+		}
+		this.stats.MaxLifetimeClosed++
+		this.close(ic.c)
+	}
+
+	return nil
+}
+
+/**
+* 补齐空闲连接到MinIdle，Dial在锁外执行，避免阻塞Get
+* 创建连接失败时停止并通过OnWarmError报告，下次回收时再补齐
+ */
+func (this *ConnPool) fillIdle() (err error) {
+	this.mu.Lock()
+	if this.closed {
+		this.mu.Unlock()
+		return ErrPoolClosed
+	}
+	minIdle := this.MinIdle
+	if minIdle > this.MaxIdle {
+		minIdle = this.MaxIdle
+	}
+	num := minIdle - this.len()
+	if this.MaxActive > 0 && num > this.MaxActive-this.active {
+		num = this.MaxActive - this.active
+	}
+	if num <= 0 {
+		this.mu.Unlock()
+		return nil
+	}
+	// 先占位，防止并发Get超过MaxActive
+	this.increActive(num)
+	this.mu.Unlock()
+
+	for i := 0; i < num; i++ {
+		conn, e := this.Dial()
+		this.mu.Lock()
+		this.dialed(conn, e)
+		if e == nil {
+			this.put(conn)
+			this.mu.Unlock()
+			continue
+		}
+		// 第一次失败即停止，不可达的server不再逐个等待连接超时，剩余的占位一并释放
+		for j := i; j < num; j++ {
+			this.releaseSlot()
+		}
+		this.mu.Unlock()
+		if this.OnWarmError != nil {
+			this.OnWarmError(e)
+		}
+		return e
+	}
+
+	return nil
+}
+
+/**
+* 记录创建连接的统计，调用方持有锁
+ */
+func (this *ConnPool) dialed(conn Conn, err error) {
+	this.stats.Dials++
+	if err != nil {
+		this.stats.DialErrors++
+	} else if conn != nil {
+		if this.conns == nil {
+			this.conns = make(map[Conn]*connInfo)
+		}
+		this.conns[conn] = &connInfo{created: time.Now()}
+	}
+}
+
+/**
+* 锁外执行TestOnBorrow，失败时记录统计
+ */
+func (this *ConnPool) testOnBorrow(conn Conn) error {
+	if this.TestOnBorrow == nil {
 		return nil
 	}
+	err := this.TestOnBorrow(conn)
+	if err != nil {
+		this.mu.Lock()
+		this.stats.BorrowTestFailures++
+		this.mu.Unlock()
+	}
+	return err
+}
 
-	e := this.idlelist.Front()
-	ic := e.Value.(idle)
-	this.idlelist.Remove(e)
+/**
+* 可用连接交给排队的Get，没人排队则放入池子
+ */
+func (this *ConnPool) put(conn Conn) {
+	if this.closed {
+		this.close(conn)
+		return
+	}
+	if this.handoff(conn) {
+		return
+	}
+	if this.overMaxIdle() {
+		this.stats.MaxIdleClosed++
+		this.close(conn)
+		return
+	}
+	this.idlelist.PushFront(idle{t: time.Now(), c: conn})
+}
 
-	return ic.c
+/**
+* 交给队首等待者，conn为nil表示交付active名额
+ */
+func (this *ConnPool) handoff(conn Conn) bool {
+	e := this.waiters.Front()
+	if e == nil {
+		return false
+	}
+	this.waiters.Remove(e)
+	e.Value.(chan Conn) <- conn
+	return true
+}
+
+/**
+* 释放一个active名额，有人排队则直接转给队首
+ */
+func (this *ConnPool) releaseSlot() {
+	if !this.handoff(nil) {
+		this.decreActive(1)
+	}
 }
 
 /**
@@ -181,11 +566,22 @@ func (this *ConnPool) len() int {
 }
 
 /**
-* 关闭连接
+* 关闭连接并释放active名额
  */
 func (this *ConnPool) close(conn Conn) {
-	this.decreActive(1)
+	this.closeConn(conn)
+	this.releaseSlot()
+}
+
+/**
+* 只关闭连接，不改变active
+ */
+func (this *ConnPool) closeConn(conn Conn) {
 	if conn != nil {
+		delete(this.conns, conn)
+		if this.OnClose != nil {
+			this.OnClose(conn)
+		}
 		conn.Close()
 	}
 }
@@ -194,6 +590,9 @@ func (this *ConnPool) close(conn Conn) {
 * 关闭过期的连接
  */
 func (this *ConnPool) closeExipredIdle() {
+	if this.IdleTimeoutS <= 0 {
+		return
+	}
 	for {
 		// 从最后往前
 		e := this.idlelist.Back()
@@ -205,16 +604,70 @@ func (this *ConnPool) closeExipredIdle() {
 			break
 		}
 		this.idlelist.Remove(e)
+		this.stats.IdleTimeoutClosed++
 		this.close(ic.c)
 	}
 }
 
+/**
+* 关闭超过存活时间的空闲连接
+ */
+func (this *ConnPool) closeOverLifetimeIdle() {
+	if this.MaxLifetimeS <= 0 {
+		return
+	}
+	for e := this.idlelist.Front(); e != nil; {
+		next := e.Next()
+		ic := e.Value.(idle)
+		if this.overLifetime(ic.c) {
+			this.idlelist.Remove(e)
+			this.stats.MaxLifetimeClosed++
+			this.close(ic.c)
+		}
+		e = next
+	}
+}
+
+/**
+* 连接超过最大存活时间
+ */
+func (this *ConnPool) overLifetime(conn Conn) bool {
+	if this.MaxLifetimeS <= 0 {
+		return false
+	}
+	info, ok := this.conns[conn]
+	if !ok {
+		return false
+	}
+	return time.Now().After(info.created.Add(time.Duration(this.MaxLifetimeS) * time.Second))
+}
+
+func (this *ConnPool) isUnusable(conn Conn) bool {
+	info, ok := this.conns[conn]
+	return ok && info.unusable
+}
+
 func (this *ConnPool) increActive(num int) {
 	this.active += num
 }
 
 func (this *ConnPool) decreActive(num int) {
 	this.active -= num
+	this.checkDrained()
+}
+
+/**
+* 关闭后连接全部释放，通知Close
+ */
+func (this *ConnPool) checkDrained() {
+	if !this.closed || this.active > 0 {
+		return
+	}
+	select {
+	case <-this.drained:
+	default:
+		close(this.drained)
+	}
 }
 
 /**
@@ -1,9 +1,13 @@
 package pool
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"math/rand"
 	"net"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -81,3 +85,557 @@ func TestPool(t *testing.T) {
 		"xxx": "Nice, you are great",
 	})
 }
+
+type fakeConn struct {
+	closed bool
+}
+
+func (c *fakeConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func newFakePool(maxActive int) *ConnPool {
+	return New(
+		maxActive,
+		maxActive,
+		0,
+		func() (Conn, error) {
+			return &fakeConn{}, nil
+		},
+		nil,
+		true,
+	)
+}
+
+func TestGetContext(t *testing.T) {
+	pool := newFakePool(1)
+	conn, err := pool.GetContext(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 取消
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := pool.GetContext(ctx); err != context.Canceled {
+		t.Fatalf("expect context.Canceled, got %v", err)
+	}
+
+	// 超时
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := pool.GetContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expect context.DeadlineExceeded, got %v", err)
+	}
+
+	// WaitTimeoutMs
+	pool.WaitTimeoutMs = 50
+	if _, err := pool.Get(); err != ErrWaitTimeout {
+		t.Fatalf("expect ErrWaitTimeout, got %v", err)
+	}
+
+	// 释放后等待者拿到连接
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		pool.Release(conn)
+	}()
+	if _, err := pool.Get(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 慢的Dial不持有锁：并发创建互不等待，ctx在创建期间结束时返回ctx.Err()并归还连接
+	slow := newFakePool(10)
+	slow.Dial = func() (Conn, error) {
+		time.Sleep(200 * time.Millisecond)
+		return &fakeConn{}, nil
+	}
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+			defer cancel()
+			if c, err := slow.GetContext(ctx); err != context.DeadlineExceeded || c != nil {
+				t.Errorf("expect context.DeadlineExceeded, got %v %v", c, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if cost := time.Since(start); cost > 400*time.Millisecond {
+		t.Fatalf("expect dials not serialized, cost %v", cost)
+	}
+	if stats := slow.Stats(); stats.Idle != 5 || stats.InUse != 0 {
+		t.Fatalf("expect dialed conns returned to pool, got %+v", stats)
+	}
+}
+
+func TestStats(t *testing.T) {
+	pool := newFakePool(1)
+	pool.WaitTimeoutMs = 10
+	conn, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Get(); err != ErrWaitTimeout {
+		t.Fatalf("expect ErrWaitTimeout, got %v", err)
+	}
+	stats := pool.Stats()
+	if stats.InUse != 1 || stats.Idle != 0 || stats.Dials != 1 || stats.WaitCount != 1 || stats.WaitDuration <= 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	pool.Release(conn)
+	stats = pool.Stats()
+	if stats.InUse != 0 || stats.Idle != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	exporter := NewExporter()
+	exporter.Register("test", pool)
+	buf := &bytes.Buffer{}
+	exporter.WriteTo(buf)
+	if !strings.Contains(buf.String(), `golib_pool_idle_connections{pool="test"} 1`) {
+		t.Fatalf("unexpected metrics output:\n%s", buf.String())
+	}
+}
+
+func TestReaper(t *testing.T) {
+	pool := newFakePool(2)
+	pool.MaxLifetimeS = 1
+	pool.StartReaper(100 * time.Millisecond)
+	defer pool.Destory()
+
+	conn, _ := pool.Get()
+	pool.Release(conn)
+	if stats := pool.Stats(); stats.Idle != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	stats := pool.Stats()
+	if stats.Idle != 0 || stats.MaxLifetimeClosed != 1 || !conn.(*fakeConn).closed {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestMinIdle(t *testing.T) {
+	dialErr := fmt.Errorf("dial failed")
+	fail := true
+	var warmErrs int
+	pool := New(
+		5,
+		3,
+		0,
+		func() (Conn, error) {
+			if fail {
+				return nil, dialErr
+			}
+			return &fakeConn{}, nil
+		},
+		nil,
+		true,
+	)
+	pool.MinIdle = 4
+	pool.OnWarmError = func(err error) {
+		warmErrs++
+	}
+	// 第一次失败即停止
+	if err := pool.Warm(); err != dialErr || warmErrs != 1 || pool.Stats().Dials != 1 {
+		t.Fatalf("expect dialErr reported once, got %v %d %+v", err, warmErrs, pool.Stats())
+	}
+	if stats := pool.Stats(); stats.Idle != 0 || pool.Active() != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// 不超过MaxActive
+	fail = false
+	if err := pool.Warm(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := pool.Stats(); stats.Idle != 3 || stats.Dials != 4 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestReleaseWithError(t *testing.T) {
+	pool := newFakePool(1)
+	broken := true
+	pool.TestOnBorrow = func(c Conn) error {
+		if broken {
+			return fmt.Errorf("ping failed")
+		}
+		return nil
+	}
+
+	// 新建连接TestOnBorrow失败，关闭并释放active
+	if conn, err := pool.Get(); err == nil || conn != nil || pool.Active() != 0 {
+		t.Fatalf("expect borrow test failure, got %v %v active=%d", conn, err, pool.Active())
+	}
+
+	// 网络错误的连接不放回池子
+	broken = false
+	conn, err := pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.ReleaseWithError(conn, fmt.Errorf("broken pipe"))
+	if stats := pool.Stats(); stats.Idle != 0 || stats.InUse != 0 || stats.BrokenClosed != 1 || !conn.(*fakeConn).closed {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// MarkUnusable
+	conn, _ = pool.Get()
+	pool.MarkUnusable(conn)
+	pool.Release(conn)
+	if stats := pool.Stats(); stats.Idle != 0 || stats.BrokenClosed != 2 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// 空闲连接TestOnBorrow失败，关闭后重新创建
+	conn, _ = pool.Get()
+	pool.Release(conn)
+	broken = true
+	if _, err := pool.Get(); err == nil || pool.Active() != 0 || !conn.(*fakeConn).closed {
+		t.Fatalf("expect idle conn closed, got %v active=%d", err, pool.Active())
+	}
+}
+
+func TestTypedPool(t *testing.T) {
+	var created, borrowed, returned, closed int
+	p := NewPool(
+		1,
+		1,
+		0,
+		func() (*fakeConn, error) {
+			return &fakeConn{}, nil
+		},
+		true,
+	)
+	p.OnCreate = func(c *fakeConn) error {
+		created++
+		return nil
+	}
+	p.OnBorrow = func(c *fakeConn) error {
+		borrowed++
+		return nil
+	}
+	p.OnReturn = func(c *fakeConn) error {
+		returned++
+		if returned > 1 {
+			return fmt.Errorf("dirty conn")
+		}
+		return nil
+	}
+	p.OnClose = func(c *fakeConn) {
+		closed++
+	}
+
+	conn, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Put(conn)
+	conn2, err := p.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn2 != conn {
+		t.Fatal("expect idle conn reused")
+	}
+	// OnReturn失败关闭连接
+	p.Put(conn2)
+	if created != 1 || borrowed != 2 || returned != 2 || closed != 1 || !conn.closed || p.Active() != 0 {
+		t.Fatalf("unexpected hooks created=%d borrowed=%d returned=%d closed=%d", created, borrowed, returned, closed)
+	}
+
+	// 调优参数与内部的ConnPool共用，预热的连接同样经过OnCreate
+	p.MinIdle = 1
+	if err := p.Warm(); err != nil || p.Stats().Idle != 1 || created != 2 {
+		t.Fatalf("unexpected warm %v %+v created=%d", err, p.Stats(), created)
+	}
+}
+
+func TestFairWait(t *testing.T) {
+	pool := newFakePool(1)
+	conn, _ := pool.Get()
+
+	// 按顺序排队
+	order := make(chan int, 3)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			c, err := pool.Get()
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			order <- i
+			time.Sleep(10 * time.Millisecond)
+			pool.Release(c)
+		}(i)
+		time.Sleep(20 * time.Millisecond)
+	}
+	pool.Release(conn)
+
+	for i := 0; i < 3; i++ {
+		if got := <-order; got != i {
+			t.Fatalf("expect waiter %d, got %d", i, got)
+		}
+	}
+}
+
+func TestIdleStrategy(t *testing.T) {
+	for _, strategy := range []IdleStrategy{IdleLIFO, IdleFIFO} {
+		pool := newFakePool(2)
+		pool.IdleStrategy = strategy
+		conn1, _ := pool.Get()
+		conn2, _ := pool.Get()
+		pool.Release(conn1)
+		pool.Release(conn2)
+
+		expect := conn2
+		if strategy == IdleFIFO {
+			expect = conn1
+		}
+		if conn, _ := pool.Get(); conn != expect {
+			t.Fatalf("strategy %d: unexpected idle conn", strategy)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	pool := newFakePool(2)
+	conn1, _ := pool.Get()
+	conn2, _ := pool.Get()
+	pool.Release(conn2)
+
+	// 等待者被唤醒
+	waitErr := make(chan error, 1)
+	conn3, _ := pool.Get()
+	go func() {
+		_, err := pool.Get()
+		waitErr <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+	pool.Release(conn3)
+	time.Sleep(20 * time.Millisecond)
+
+	// 归还后优雅关闭
+	done := make(chan error, 1)
+	go func() {
+		done <- pool.Close(context.Background())
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if _, err := pool.Get(); err != ErrPoolClosed {
+		t.Fatalf("expect ErrPoolClosed, got %v", err)
+	}
+	select {
+	case <-done:
+		t.Fatal("expect Close waiting for in-flight conns")
+	default:
+	}
+	pool.Release(conn1)
+	if err := <-waitErr; err != nil {
+		t.Fatalf("expect waiter got conn3, got %v", err)
+	}
+	pool.Release(conn3)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if pool.Active() != 0 || !conn1.(*fakeConn).closed || !conn3.(*fakeConn).closed {
+		t.Fatalf("expect all conns closed, active=%d", pool.Active())
+	}
+
+	// 超时强制关闭
+	pool = newFakePool(1)
+	conn, _ := pool.Get()
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := pool.Close(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("expect DeadlineExceeded, got %v", err)
+	}
+	if pool.Active() != 0 || !conn.(*fakeConn).closed {
+		t.Fatalf("expect force closed, active=%d", pool.Active())
+	}
+	pool.Release(conn)
+	if pool.Active() != 0 {
+		t.Fatalf("expect release after force close ignored, active=%d", pool.Active())
+	}
+}
+
+func TestMultiPool(t *testing.T) {
+	down := map[string]bool{"b": true}
+	var mu sync.Mutex
+	m := NewMultiPool(
+		[]Endpoint{{Addr: "a", Weight: 1}, {Addr: "b", Weight: 1}, {Addr: "c", Weight: 2}},
+		func(addr string) *Pool[*fakeConn] {
+			return NewPool(10, 10, 0, func() (*fakeConn, error) {
+				mu.Lock()
+				defer mu.Unlock()
+				if down[addr] {
+					return nil, fmt.Errorf("dial %s failed", addr)
+				}
+				return &fakeConn{}, nil
+			}, true)
+		},
+	)
+	m.Balance = BalanceRoundRobin
+	m.MaxFailures = 1
+	m.EjectMs = 100
+
+	// b失败后被摘除，请求落到其它节点
+	for i := 0; i < 8; i++ {
+		conn, err := m.Get()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Put(conn)
+	}
+	for _, node := range m.Nodes() {
+		if node.Addr == "b" && !node.Ejected {
+			t.Fatalf("expect b ejected, got %+v", node)
+		}
+	}
+	if stats := m.Stats(); stats.Dials < 2 || stats.DialErrors != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	// 恢复后探活重新加入
+	mu.Lock()
+	down["b"] = false
+	mu.Unlock()
+	m.StartProbe(50 * time.Millisecond)
+	defer m.Destory()
+	time.Sleep(200 * time.Millisecond)
+	for _, node := range m.Nodes() {
+		if node.Ejected || node.Failures != 0 {
+			t.Fatalf("expect all nodes healthy, got %+v", node)
+		}
+	}
+
+	// 加权轮询 a:b:c = 1:1:2
+	count := map[*fakeConn]int{}
+	var conns []*fakeConn
+	for i := 0; i < 4; i++ {
+		conn, _ := m.Get()
+		conns = append(conns, conn)
+		count[conn]++
+	}
+	for _, conn := range conns {
+		m.Put(conn)
+	}
+	inUse := 0
+	for _, node := range m.Nodes() {
+		inUse += node.Stats.InUse
+		if node.Addr == "c" && node.Stats.Idle != 2 {
+			t.Fatalf("expect c got 2 conns, got %+v", node)
+		}
+	}
+	if inUse != 0 {
+		t.Fatalf("expect all conns returned, in use %d", inUse)
+	}
+}
+
+func TestMultiPoolSlowNode(t *testing.T) {
+	dialing := make(chan struct{}, 10)
+	release := make(chan struct{})
+	m := NewMultiPool(
+		[]Endpoint{{Addr: "fast"}, {Addr: "slow"}},
+		func(addr string) *Pool[*fakeConn] {
+			return NewPool(10, 10, 0, func() (*fakeConn, error) {
+				if addr == "slow" {
+					dialing <- struct{}{}
+					<-release
+				}
+				return &fakeConn{}, nil
+			}, true)
+		},
+	)
+	m.Balance = BalanceLeastConn
+	defer m.Destory()
+	released := false
+	defer func() {
+		if !released {
+			close(release)
+		}
+	}()
+
+	conn, err := m.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// slow节点创建连接阻塞时，其它请求的选择以及fast节点的归还不受影响
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if c, err := m.Get(); err == nil {
+				m.Put(c)
+			}
+		}()
+	}
+	<-dialing
+	time.Sleep(20 * time.Millisecond)
+
+	done := make(chan struct{})
+	go func() {
+		m.Put(conn)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Put blocked by slow node")
+	}
+	close(release)
+	released = true
+	wg.Wait()
+}
+
+func TestMultiPoolProbeTimeout(t *testing.T) {
+	m := NewMultiPool(
+		[]Endpoint{{Addr: "a"}, {Addr: "b"}},
+		func(addr string) *Pool[*fakeConn] {
+			return NewPool(1, 1, 0, func() (*fakeConn, error) {
+				return &fakeConn{}, nil
+			}, true)
+		},
+	)
+	m.ProbeTimeoutMs = 50
+	defer m.Destory()
+
+	// a的连接池已满且被摘除，探活超时后继续探测b
+	conn, err := m.nodes[0].pool.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.nodes[0].pool.Put(conn)
+	m.mu.Lock()
+	for _, n := range m.nodes {
+		n.ejectedUntil = time.Now().Add(-time.Millisecond)
+	}
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.probe()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("probe blocked by saturated node")
+	}
+	for _, node := range m.Nodes() {
+		if node.Addr == "b" && node.Ejected {
+			t.Fatalf("expect b recovered, got %+v", node)
+		}
+	}
+}
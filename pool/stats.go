@@ -0,0 +1,121 @@
+package pool
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Stats 连接池统计快照
+type Stats struct {
+	Idle  int // 池子中的空闲连接数
+	InUse int // 正在被使用的连接数
+
+	Dials              int64         // 累计创建连接次数
+	DialErrors         int64         // 累计创建连接失败次数
+	WaitCount          int64         // 累计等待连接的次数
+	WaitDuration       time.Duration // 累计等待连接的耗时
+	BorrowTestFailures int64         // 累计TestOnBorrow失败次数
+	IdleTimeoutClosed  int64         // 因空闲超时关闭的连接数
+	MaxIdleClosed      int64         // 因超过MaxIdle关闭的连接数
+	MaxLifetimeClosed  int64         // 因超过MaxLifetimeS关闭的连接数
+	BrokenClosed       int64         // 因连接出错或被标记不可用关闭的连接数
+}
+
+// StatsReporter 能够提供统计快照的连接池
+type StatsReporter interface {
+	Stats() Stats
+}
+
+// Exporter 以Prometheus文本格式输出已注册连接池的统计，按名称区分
+type Exporter struct {
+	mu    sync.RWMutex
+	pools map[string]StatsReporter
+}
+
+// DefaultExporter 默认exporter，redis等client在Init时注册到这里
+var DefaultExporter = NewExporter()
+
+func NewExporter() *Exporter {
+	return &Exporter{pools: make(map[string]StatsReporter)}
+}
+
+/**
+* 注册连接池，同名覆盖
+ */
+func (e *Exporter) Register(name string, p StatsReporter) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.pools[name] = p
+}
+
+func (e *Exporter) Unregister(name string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.pools, name)
+}
+
+/**
+* 获取所有已注册连接池的统计快照
+ */
+func (e *Exporter) Snapshot() map[string]Stats {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	snapshot := make(map[string]Stats, len(e.pools))
+	for name, p := range e.pools {
+		snapshot[name] = p.Stats()
+	}
+	return snapshot
+}
+
+type metric struct {
+	name  string
+	typ   string
+	help  string
+	value func(Stats) float64
+}
+
+var metrics = []metric{
+	{"golib_pool_idle_connections", "gauge", "Number of idle connections.", func(s Stats) float64 { return float64(s.Idle) }},
+	{"golib_pool_in_use_connections", "gauge", "Number of connections in use.", func(s Stats) float64 { return float64(s.InUse) }},
+	{"golib_pool_dials_total", "counter", "Total number of dials.", func(s Stats) float64 { return float64(s.Dials) }},
+	{"golib_pool_dial_errors_total", "counter", "Total number of failed dials.", func(s Stats) float64 { return float64(s.DialErrors) }},
+	{"golib_pool_wait_total", "counter", "Total number of waits for a connection.", func(s Stats) float64 { return float64(s.WaitCount) }},
+	{"golib_pool_wait_seconds_total", "counter", "Total time spent waiting for a connection.", func(s Stats) float64 { return s.WaitDuration.Seconds() }},
+	{"golib_pool_borrow_test_failures_total", "counter", "Total number of failed TestOnBorrow checks.", func(s Stats) float64 { return float64(s.BorrowTestFailures) }},
+	{"golib_pool_idle_timeout_closed_total", "counter", "Total number of connections closed due to idle timeout.", func(s Stats) float64 { return float64(s.IdleTimeoutClosed) }},
+	{"golib_pool_max_idle_closed_total", "counter", "Total number of connections closed due to MaxIdle.", func(s Stats) float64 { return float64(s.MaxIdleClosed) }},
+	{"golib_pool_max_lifetime_closed_total", "counter", "Total number of connections closed due to MaxLifetimeS.", func(s Stats) float64 { return float64(s.MaxLifetimeClosed) }},
+	{"golib_pool_broken_closed_total", "counter", "Total number of broken connections closed on release.", func(s Stats) float64 { return float64(s.BrokenClosed) }},
+}
+
+/**
+* 按Prometheus文本格式输出
+ */
+func (e *Exporter) WriteTo(w io.Writer) (int64, error) {
+	snapshot := e.Snapshot()
+	names := make([]string, 0, len(snapshot))
+	for name := range snapshot {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	buf := &bytes.Buffer{}
+	for _, m := range metrics {
+		fmt.Fprintf(buf, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(buf, "# TYPE %s %s\n", m.name, m.typ)
+		for _, name := range names {
+			fmt.Fprintf(buf, "%s{pool=%q} %v\n", m.name, name, m.value(snapshot[name]))
+		}
+	}
+	return buf.WriteTo(w)
+}
+
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	e.WriteTo(w)
+}
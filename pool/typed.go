@@ -0,0 +1,123 @@
+package pool
+
+import (
+	"context"
+	"time"
+)
+
+// Pool 泛型连接池，在ConnPool之上提供类型安全的Get/Put以及生命周期钩子
+// ConnPool不对外暴露，连接只能经Put/PutWithError归还，钩子不会被绕过
+// 调优参数与内部的ConnPool共用，统计、预热、回收、关闭通过同名方法转发
+type Pool[T Conn] struct {
+	*Options
+
+	OnCreate func(T) error // 新建连接后调用，比如AUTH/SELECT，失败则关闭连接
+	OnBorrow func(T) error // 借出前调用，比如PING/角色检查，失败则关闭连接重新获取
+	OnReturn func(T) error // 归还时调用，失败则关闭连接而不放回池子
+	OnClose  func(T)       // 关闭连接前调用
+
+	pool *ConnPool
+}
+
+func NewPool[T Conn](
+	maxIdle int,
+	maxActive int,
+	idleTimeoutS int,
+	dial func() (T, error),
+	wait bool,
+) *Pool[T] {
+	p := &Pool[T]{}
+	p.pool = New(
+		maxIdle,
+		maxActive,
+		idleTimeoutS,
+		func() (Conn, error) {
+			c, err := dial()
+			if err != nil {
+				return nil, err
+			}
+			if p.OnCreate != nil {
+				if err = p.OnCreate(c); err != nil {
+					c.Close()
+					return nil, err
+				}
+			}
+			return c, nil
+		},
+		func(c Conn) error {
+			if p.OnBorrow != nil {
+				return p.OnBorrow(c.(T))
+			}
+			return nil
+		},
+		wait,
+	)
+	p.pool.OnClose = func(c Conn) {
+		if p.OnClose != nil {
+			p.OnClose(c.(T))
+		}
+	}
+	p.Options = &p.pool.Options
+
+	return p
+}
+
+func (p *Pool[T]) Get() (conn T, err error) {
+	return p.GetContext(context.Background())
+}
+
+func (p *Pool[T]) GetContext(ctx context.Context) (conn T, err error) {
+	c, err := p.pool.GetContext(ctx)
+	if err != nil || c == nil {
+		return conn, err
+	}
+	return c.(T), nil
+}
+
+/**
+* 归还连接
+ */
+func (p *Pool[T]) Put(conn T) {
+	p.PutWithError(conn, nil)
+}
+
+/**
+* 归还连接，err不为nil或OnReturn失败时关闭连接
+ */
+func (p *Pool[T]) PutWithError(conn T, err error) {
+	if err == nil && p.OnReturn != nil {
+		err = p.OnReturn(conn)
+	}
+	p.pool.ReleaseWithError(conn, err)
+}
+
+/**
+* 标记连接不可用，Put时关闭而不放回池子
+ */
+func (p *Pool[T]) MarkUnusable(conn T) {
+	p.pool.MarkUnusable(conn)
+}
+
+func (p *Pool[T]) Active() int {
+	return p.pool.Active()
+}
+
+func (p *Pool[T]) Stats() Stats {
+	return p.pool.Stats()
+}
+
+func (p *Pool[T]) Warm() error {
+	return p.pool.Warm()
+}
+
+func (p *Pool[T]) StartReaper(interval time.Duration) {
+	p.pool.StartReaper(interval)
+}
+
+func (p *Pool[T]) Close(ctx context.Context) error {
+	return p.pool.Close(ctx)
+}
+
+func (p *Pool[T]) Destory() {
+	p.pool.Destory()
+}